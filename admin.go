@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+)
+
+// 本地控制接口，所有请求都需要携带令牌
+func startAdminServer(addr, token string) {
+	uiURL := "http://" + addr + "/ui/"
+	if token == "" {
+		buf := make([]byte, 16)
+		rand.Read(buf)
+		token = hex.EncodeToString(buf)
+		uiURL += "#token=" + token
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/stats", handleStats)
+	mux.HandleFunc("GET /api/ca.crt", handleCA)
+	mux.HandleFunc("GET /api/scope", handleScopeGet)
+	mux.HandleFunc("PUT /api/scope", handleScopeSet)
+	mux.HandleFunc("GET /api/rules", handleRuleList)
+	mux.HandleFunc("GET /api/rules/profile", handleRuleProfile)
+	mux.HandleFunc("GET /api/notify", handleNotifyStats)
+	mux.HandleFunc("GET /api/logger", handleLoggerGet)
+	mux.HandleFunc("PUT /api/logger", handleLoggerSet)
+	mux.HandleFunc("POST /api/logger/rotate", handleLoggerRotate)
+	mux.HandleFunc("PUT /api/rules/{id}", handleRuleToggle)
+	mux.HandleFunc("GET /api/findings", handleFindingList)
+	mux.HandleFunc("GET /api/findings/{id}", handleFindingGet)
+	mux.HandleFunc("PUT /api/findings/{id}", handleFindingUpdate)
+	mux.HandleFunc("GET /api/history", handleHistoryList)
+	mux.HandleFunc("GET /api/history/{id}", handleHistoryGet)
+	mux.HandleFunc("POST /api/history/{id}/replay", handleReplay)
+	mux.HandleFunc("GET /api/endpoints", handleEndpointList)
+	mux.HandleFunc("GET /api/endpoints/hosts", handleEndpointHosts)
+	mux.HandleFunc("GET /api/endpoints/export", handleEndpointExport)
+	mux.HandleFunc("GET /api/harvest", handleHarvestList)
+	mux.HandleFunc("GET /api/archive", handleArchiveList)
+	mux.HandleFunc("GET /api/archive/{sha256}", handleArchiveGet)
+	mux.HandleFunc("GET /api/harvest/export", handleHarvestExport)
+	mux.HandleFunc("GET /api/intercept", handleInterceptList)
+	mux.HandleFunc("PUT /api/intercept", handleInterceptToggle)
+	mux.HandleFunc("PUT /api/intercept/filters", handleInterceptFilters)
+	mux.HandleFunc("GET /api/intercept/{id}", handleInterceptGet)
+	mux.HandleFunc("POST /api/intercept/{id}", handleInterceptResolve)
+
+	// 网页界面的静态文件不需要令牌，接口请求仍需令牌
+	root := http.NewServeMux()
+	root.Handle("/api/", requireToken(token, mux))
+	root.Handle("GET /metrics", requireToken(token, metricsHandler()))
+	root.Handle("/ui/", webUIHandler())
+	root.Handle("GET /{$}", http.RedirectHandler("/ui/", http.StatusFound))
+
+	go func() {
+		logger.Infof("控制接口监听在 %s，网页界面 %s", addr, uiURL)
+		if err := http.ListenAndServe(addr, root); err != nil {
+			logger.Errorf("控制接口启动失败: %v", err)
+		}
+	}()
+}
+
+// 令牌可以放在 Authorization: Bearer、X-Gopr-Token 请求头或 token 查询参数中
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get("X-Gopr-Token")
+		if got == "" {
+			got = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if got == "" {
+			got = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func pathID(r *http.Request) (int64, error) {
+	return strconv.ParseInt(r.PathValue("id"), 10, 64)
+}
+
+// 按 offset 和 limit 查询参数分页，limit 默认100
+func paginate[T any](r *http.Request, list []T) map[string]interface{} {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	total := len(list)
+	if offset < 0 || offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	items := list[offset:end]
+	if items == nil {
+		items = []T{}
+	}
+	return map[string]interface{}{
+		"total":  total,
+		"offset": offset,
+		"items":  items,
+	}
+}
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, currentStats())
+}
+
+// 下载CA证书，方便导入浏览器
+func handleCA(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+	w.Header().Set("Content-Disposition", `attachment; filename="gopr-ca.crt"`)
+	w.Write(caCert)
+}
+
+func handleScopeGet(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, scopeManager.Config())
+}
+
+func handleScopeSet(w http.ResponseWriter, r *http.Request) {
+	cfg := scopeManager.Config()
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	scopeManager.SetConfig(cfg)
+	logger.Infof("扫描范围已更新: 启用=%v 包含=%v", cfg.Enabled, cfg.Include)
+	writeJSON(w, http.StatusOK, scopeManager.Config())
+}
+
+func handleRuleList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, regexManager.Rules())
+}
+
+func handleRuleToggle(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := regexManager.SetRuleEnabled(int(id), req.Enabled); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "enabled": req.Enabled})
+}
+
+func handleInterceptList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled": interceptManager.Enabled(),
+		"pending": interceptManager.Pending(),
+	})
+}
+
+func handleInterceptToggle(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	interceptManager.SetEnabled(req.Enabled)
+	logger.Infof("[intercept] 拦截已%s", map[bool]string{true: "开启", false: "关闭"}[req.Enabled])
+	writeJSON(w, http.StatusOK, map[string]bool{"enabled": req.Enabled})
+}
+
+func handleInterceptFilters(w http.ResponseWriter, r *http.Request) {
+	var req []struct {
+		Phase       string   `json:"phase"`
+		Methods     []string `json:"methods"`
+		URL         string   `json:"url"`
+		ContentType string   `json:"content_type"`
+		Timeout     string   `json:"timeout"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	filters := make([]fuzhu.InterceptFilter, 0, len(req))
+	for _, f := range req {
+		if f.ContentType != "" && f.Phase == fuzhu.InterceptPhaseRequest {
+			writeError(w, http.StatusBadRequest, errors.New("content_type 只能用于响应阶段"))
+			return
+		}
+		filter := fuzhu.InterceptFilter{Phase: f.Phase, Methods: f.Methods, ContentType: f.ContentType}
+		if f.URL != "" {
+			re, err := regexp.Compile(f.URL)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			filter.URLPattern = re
+		}
+		if f.Timeout != "" {
+			timeout, err := time.ParseDuration(f.Timeout)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			filter.Timeout = timeout
+		}
+		filters = append(filters, filter)
+	}
+	interceptManager.SetFilters(filters)
+	writeJSON(w, http.StatusOK, map[string]int{"filters": len(filters)})
+}
+
+func handleInterceptGet(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	item, ok := interceptManager.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fuzhu.ErrInterceptNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// 请求体为 InterceptDecision，action 为 forward 或 drop，编辑字段可选
+func handleInterceptResolve(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var d fuzhu.InterceptDecision
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := interceptManager.Resolve(id, d); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, fuzhu.ErrInterceptNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "action": d.Action})
+}
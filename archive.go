@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+)
+
+var (
+	archiver           *fuzhu.Archiver
+	errArchiveDisabled = errors.New("archiver is disabled")
+)
+
+// 按 -archive-types 打开归档目录
+func setupArchiver(dir, kinds string, maxSize int64) error {
+	var list []string
+	for _, kind := range strings.Split(kinds, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			list = append(list, kind)
+		}
+	}
+	a, err := fuzhu.NewArchiver(dir, list, maxSize)
+	if err != nil {
+		return err
+	}
+	archiver = a
+	logger.Infof("归档 %s 到 %s，已有 %d 项", strings.Join(list, ","), dir, a.Stats().Entries)
+	return nil
+}
+
+// 响应是否需要为归档读取响应体，已知超过大小上限的不读取
+func wantsArchive(resp *http.Response, rawURL string, sniffed fuzhu.ContentClass) bool {
+	return archiver != nil && resp.StatusCode == http.StatusOK && resp.ContentLength <= archiver.MaxSize() &&
+		archiver.Wants(resp.Header.Get("Content-Type"), rawURL, sniffed)
+}
+
+// 只为归档或提取元数据读取跳过扫描的响应体时的大小上限，0 表示不需要读取
+func skippedBodyLimit(resp *http.Response, rawURL string, sniffed fuzhu.ContentClass) int64 {
+	var limit int64
+	if wantsArchive(resp, rawURL, sniffed) {
+		limit = archiver.MaxSize()
+	}
+	if wantsMetadata(resp, sniffed) {
+		limit = max(limit, fuzhu.MetadataMaxSize)
+	}
+	return limit
+}
+
+// 最多读取 limit 字节，超出时把已读的部分放回响应体，剩余部分原样转发，返回 false
+func readBodyLimited(resp *http.Response, limit int64) ([]byte, bool) {
+	return readPrefix(&resp.Body, limit)
+}
+
+// 最多读取 limit 字节，body 被替换为已读部分加剩余部分，不会把超出的内容读进内存
+func readPrefix(body *io.ReadCloser, limit int64) ([]byte, bool) {
+	if *body == nil || *body == http.NoBody {
+		return nil, true
+	}
+	data, _ := io.ReadAll(io.LimitReader(*body, limit+1))
+	if int64(len(data)) > limit {
+		*body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), *body), *body}
+		return data[:limit], false
+	}
+	(*body).Close()
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, true
+}
+
+func archiveResponse(data ResponseData) {
+	if archiver == nil {
+		return
+	}
+	entry, isNew, err := archiver.Save(data.URL, data.ContentType, data.Body)
+	if err != nil {
+		logger.Warnf("[archive] 保存 %s 失败: %v", data.URL, err)
+		return
+	}
+	if isNew {
+		logger.Debugf("[archive] %s -> %s", data.URL, entry.Path)
+	}
+}
+
+// GET /api/archive?kind=&host=&offset=&limit=
+func handleArchiveList(w http.ResponseWriter, r *http.Request) {
+	if archiver == nil {
+		writeError(w, http.StatusServiceUnavailable, errArchiveDisabled)
+		return
+	}
+	host := r.URL.Query().Get("host")
+	var list []fuzhu.ArchiveEntry
+	for _, e := range archiver.List(r.URL.Query().Get("kind")) {
+		if host == "" || strings.Contains(e.URL, host) {
+			list = append(list, e)
+		}
+	}
+	writeJSON(w, http.StatusOK, paginate(r, list))
+}
+
+// GET /api/archive/{sha256} 下载归档的内容
+func handleArchiveGet(w http.ResponseWriter, r *http.Request) {
+	if archiver == nil {
+		writeError(w, http.StatusServiceUnavailable, errArchiveDisabled)
+		return
+	}
+	f, err := archiver.Open(r.PathValue("sha256"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	io.Copy(w, f)
+}
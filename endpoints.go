@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+)
+
+// 从 JS/HTML 响应中提取的端点清单
+var endpointInventory = fuzhu.NewEndpointInventory()
+
+// 提取端点并加入清单，范围外的主机不记录
+func collectEndpoints(inv *fuzhu.EndpointInventory, source, contentType string, body []byte) int {
+	if !fuzhu.IsEndpointSource(contentType, source) {
+		return 0
+	}
+	list := fuzhu.ExtractEndpoints(body, source)
+	inScope := list[:0]
+	for _, e := range list {
+		if e.URL != "" {
+			if u, err := url.Parse(e.URL); err != nil || shouldSkipHost(u.Host) {
+				continue
+			}
+		}
+		inScope = append(inScope, e)
+	}
+	return inv.Add(source, inScope)
+}
+
+// 按格式写出端点清单
+func writeEndpoints(w http.ResponseWriter, format, host string, list []fuzhu.Endpoint) error {
+	switch format {
+	case "", "json":
+		writeJSON(w, http.StatusOK, list)
+	case "wordlist":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, word := range fuzhu.Wordlist(list) {
+			fmt.Fprintln(w, word)
+		}
+	case "openapi":
+		writeJSON(w, http.StatusOK, fuzhu.OpenAPI(host, list))
+	default:
+		return errors.New("format 只能是 json、wordlist 或 openapi")
+	}
+	return nil
+}
+
+// GET /api/endpoints?host=&q=&offset=&limit=
+func handleEndpointList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	list := endpointInventory.List(r.URL.Query().Get("host"))
+	if q != "" {
+		filtered := list[:0]
+		for _, ep := range list {
+			if strings.Contains(ep.Path, q) || strings.Contains(strings.Join(ep.Operations, " "), q) {
+				filtered = append(filtered, ep)
+			}
+		}
+		list = filtered
+	}
+	writeJSON(w, http.StatusOK, paginate(r, list))
+}
+
+// GET /api/endpoints/hosts
+func handleEndpointHosts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, endpointInventory.Hosts())
+}
+
+// GET /api/endpoints/export?host=&format=json|wordlist|openapi
+func handleEndpointExport(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	if err := writeEndpoints(w, r.URL.Query().Get("format"), host, endpointInventory.List(host)); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+	}
+}
+
+// gopr endpoints [选项]，从历史记录重新提取端点清单
+func runEndpointsCommand(args []string) {
+	fs := flag.NewFlagSet("endpoints", flag.ExitOnError)
+	historyFlag := fs.String("history", "history", "历史记录目录")
+	hostFlag := fs.String("host", "", "只导出该主机的端点")
+	formatFlag := fs.String("format", "wordlist", "导出格式 (json/wordlist/openapi)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: gopr endpoints [选项]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	store, err := fuzhu.OpenHistoryStore(*historyFlag)
+	if err != nil {
+		logger.Fatal("打开历史记录失败:", err)
+	}
+	inv := fuzhu.NewEndpointInventory()
+	for _, s := range store.Summaries() {
+		ex, err := store.Get(s.ID)
+		if err != nil {
+			logger.Warnf("读取历史记录 #%d 失败: %v", s.ID, err)
+			continue
+		}
+		collectEndpoints(inv, ex.URL, ex.ResponseHeader.Get("Content-Type"), ex.ResponseBody)
+	}
+	list := inv.List(*hostFlag)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	switch *formatFlag {
+	case "json":
+		enc.Encode(list)
+	case "wordlist":
+		for _, word := range fuzhu.Wordlist(list) {
+			fmt.Println(word)
+		}
+	case "openapi":
+		enc.Encode(fuzhu.OpenAPI(*hostFlag, list))
+	default:
+		logger.Fatal("未知的导出格式:", *formatFlag)
+	}
+}
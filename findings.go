@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+)
+
+// 定期把重复命中的次数写入结果文件，异常退出时最多丢失一个周期的计数
+const findingSyncInterval = time.Minute
+
+func syncFindingsLoop() {
+	for range time.Tick(findingSyncInterval) {
+		if err := findingStore.Sync(); err != nil {
+			logger.Warnf("保存扫描结果失败: %v", err)
+		}
+	}
+}
+
+// 保存一条匹配结果，JWT 和 SAML 会先在本地解析并检查，保存的值按 -redact 脱敏
+func saveFinding(data ResponseData, m fuzhu.Match, ctx *fuzhu.MatchContext) {
+	if findingStore == nil {
+		return
+	}
+	f := &fuzhu.Finding{
+		Time:        time.Now(),
+		ExchangeID:  data.ExchangeID,
+		Method:      data.Method,
+		URL:         data.URL,
+		Host:        data.Host,
+		Rule:        m.Rule,
+		Severity:    m.Severity,
+		Value:       fuzhu.RedactSecret(m.GroupValues[0], contextOptions.Redact),
+		ValueHash:   fuzhu.SecretHash(m.GroupValues[0]),
+		Validations: m.Validations,
+		Token:       fuzhu.IntrospectToken(m.Secret, time.Now()).Redacted(contextOptions.Redact),
+		Context:     ctx,
+		Decoding:    m.Decoding,
+		SourceFile:  data.SourceFile,
+		Path:        m.Path,
+	}
+	if f.Token != nil {
+		for _, issue := range f.Token.Issues {
+			// 可伪造的令牌
+			if issue == fuzhu.TokenIssueAlgNone || issue == fuzhu.TokenIssueWeakSecret {
+				f.Severity = fuzhu.SeverityCritical
+			}
+		}
+	}
+	saved, isNew := findingStore.Add(f)
+	if !isNew {
+		return
+	}
+	if f.Token != nil && len(f.Token.Issues) > 0 {
+		logger.Warnf("[token] #%d %s %s", saved.ID, data.URL, f.Token)
+	}
+	if notifier != nil {
+		notifier.Notify(saved)
+	}
+	logger.Finding(*saved)
+}
+
+// GET /api/findings?rule=&host=&q=&fp=&offset=&limit=
+// fp=0 只返回非误报，fp=1 只返回误报
+func handleFindingList(w http.ResponseWriter, r *http.Request) {
+	if findingStore == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("findings store is disabled"))
+		return
+	}
+	query := r.URL.Query()
+	rule, host, q, fp := query.Get("rule"), query.Get("host"), query.Get("q"), query.Get("fp")
+	var list []fuzhu.Finding
+	for _, f := range findingStore.List() {
+		if (fp == "0" && f.FalsePositive) || (fp == "1" && !f.FalsePositive) {
+			continue
+		}
+		if rule != "" && f.Rule != rule {
+			continue
+		}
+		if host != "" && !strings.Contains(f.Host, host) {
+			continue
+		}
+		if q != "" && !strings.Contains(f.Value, q) && !strings.Contains(f.URL, q) {
+			continue
+		}
+		list = append(list, f)
+	}
+	writeJSON(w, http.StatusOK, paginate(r, list))
+}
+
+func handleFindingGet(w http.ResponseWriter, r *http.Request) {
+	if findingStore == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("findings store is disabled"))
+		return
+	}
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	f, err := findingStore.Get(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
+
+// PUT /api/findings/{id}，请求体 {"false_positive": true}
+func handleFindingUpdate(w http.ResponseWriter, r *http.Request) {
+	if findingStore == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("findings store is disabled"))
+		return
+	}
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req struct {
+		FalsePositive bool `json:"false_positive"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	f, err := findingStore.SetFalsePositive(id, req.FalsePositive)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
@@ -0,0 +1,380 @@
+package fuzhu
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 归档的内容类别
+const (
+	ArchiveImage   = "image"
+	ArchiveJS      = "js"
+	ArchiveJSON    = "json"
+	ArchivePDF     = "pdf"
+	ArchiveArchive = "archive" // zip、gzip、tar、7z、rar、jar 等
+)
+
+var ArchiveKinds = []string{ArchiveImage, ArchiveJS, ArchiveJSON, ArchivePDF, ArchiveArchive}
+
+var archiveExtKinds = map[string]string{
+	".png": ArchiveImage, ".jpg": ArchiveImage, ".jpeg": ArchiveImage, ".gif": ArchiveImage,
+	".webp": ArchiveImage, ".svg": ArchiveImage, ".ico": ArchiveImage, ".bmp": ArchiveImage, ".avif": ArchiveImage,
+	".js": ArchiveJS, ".mjs": ArchiveJS,
+	".json": ArchiveJSON, ".map": ArchiveJSON,
+	".pdf": ArchivePDF,
+	".zip": ArchiveArchive, ".gz": ArchiveArchive, ".tgz": ArchiveArchive, ".tar": ArchiveArchive,
+	".7z": ArchiveArchive, ".rar": ArchiveArchive, ".jar": ArchiveArchive, ".war": ArchiveArchive, ".apk": ArchiveArchive,
+}
+
+// 内容类型对应的扩展名，地址中没有扩展名时使用
+var archiveTypeExts = map[string]string{
+	"image/png": ".png", "image/jpeg": ".jpg", "image/gif": ".gif", "image/webp": ".webp",
+	"image/svg+xml": ".svg", "image/x-icon": ".ico", "image/vnd.microsoft.icon": ".ico",
+	"image/bmp": ".bmp", "image/avif": ".avif",
+	"application/javascript": ".js", "text/javascript": ".js", "application/x-javascript": ".js",
+	"application/json": ".json", "application/pdf": ".pdf",
+	"application/zip": ".zip", "application/gzip": ".gz", "application/x-gzip": ".gz",
+	"application/x-tar": ".tar", "application/x-7z-compressed": ".7z",
+	"application/x-rar-compressed": ".rar", "application/vnd.rar": ".rar", "application/java-archive": ".jar",
+}
+
+var archiveKindExts = map[string]string{ArchiveJS: ".js", ArchiveJSON: ".json", ArchivePDF: ".pdf"}
+
+// ArchiveKind 判断归档类别，不属于任何类别时返回空：
+// 能按文件头识别的二进制内容以识别结果为准，文本和无法识别的内容按内容类型和地址判断
+func ArchiveKind(contentType, rawURL string, sniffed ContentClass) string {
+	switch sniffed.Kind {
+	case ContentImage:
+		return ArchiveImage
+	case ContentPDF:
+		return ArchivePDF
+	case ContentArchive, ContentOffice:
+		return ArchiveArchive
+	case ContentText:
+		// 声称是图片等二进制类型的文本不归档
+		if kind := declaredArchiveKind(contentType, rawURL); kind == ArchiveJS || kind == ArchiveJSON {
+			return kind
+		}
+		return ""
+	case "", ContentBinary:
+		return declaredArchiveKind(contentType, rawURL)
+	}
+	return ""
+}
+
+// 按内容类型和地址判断归档类别
+func declaredArchiveKind(contentType, rawURL string) string {
+	ct := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	switch {
+	case strings.HasPrefix(ct, "image/"):
+		return ArchiveImage
+	case strings.Contains(ct, "javascript"), strings.Contains(ct, "ecmascript"):
+		return ArchiveJS
+	case strings.Contains(ct, "json"):
+		return ArchiveJSON
+	case ct == "application/pdf":
+		return ArchivePDF
+	case strings.Contains(ct, "zip"), strings.Contains(ct, "tar"), strings.Contains(ct, "compressed"),
+		strings.Contains(ct, "rar"), ct == "application/java-archive":
+		return ArchiveArchive
+	}
+	// 内容类型缺失或为通用类型时按扩展名判断
+	if ct == "" || ct == "application/octet-stream" || ct == "binary/octet-stream" {
+		return archiveExtKinds[urlExt(rawURL)]
+	}
+	return ""
+}
+
+// 地址路径的小写扩展名
+func urlExt(rawURL string) string {
+	p := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		p = u.Path
+	}
+	return strings.ToLower(path.Ext(p))
+}
+
+// 归档索引中的一项，同一内容出现在不同地址时各记录一次
+type ArchiveEntry struct {
+	SHA256      string    `json:"sha256"`
+	Size        int64     `json:"size"`
+	Kind        string    `json:"kind"`
+	ContentType string    `json:"content_type,omitempty"`
+	MIME        string    `json:"mime,omitempty"` // 按文件头识别的类型
+	URL         string    `json:"url"`
+	Path        string    `json:"path"` // 镜像文件，相对于归档目录
+	Time        time.Time `json:"time"`
+}
+
+func (e *ArchiveEntry) key() string {
+	return e.SHA256 + "\x00" + e.URL
+}
+
+// 归档统计
+type ArchiveStats struct {
+	Entries int   `json:"entries"`
+	Blobs   int   `json:"blobs"`
+	Bytes   int64 `json:"bytes"` // 去重后的内容大小
+}
+
+// 响应内容归档：内容按 SHA-256 保存在 blobs/ 下，sites/主机/路径 镜像原地址，
+// 索引追加写入 index.jsonl，重启后据此去重
+type Archiver struct {
+	dir     string
+	kinds   map[string]bool
+	maxSize int64
+	file    *os.File
+	entries []*ArchiveEntry
+	byKey   map[string]bool
+	blobs   map[string]int64 // SHA-256 -> 大小
+	paths   map[string]string
+	mu      sync.RWMutex
+}
+
+// NewArchiver 打开归档目录，kinds 为要归档的类别，maxSize 为单个响应的大小上限
+func NewArchiver(dir string, kinds []string, maxSize int64) (*Archiver, error) {
+	a := &Archiver{
+		dir:     dir,
+		kinds:   make(map[string]bool),
+		maxSize: maxSize,
+		byKey:   make(map[string]bool),
+		blobs:   make(map[string]int64),
+		paths:   make(map[string]string),
+	}
+	for _, kind := range kinds {
+		if !slices.Contains(ArchiveKinds, kind) {
+			return nil, fmt.Errorf("unknown archive kind %q", kind)
+		}
+		a.kinds[kind] = true
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0755); err != nil {
+		return nil, err
+	}
+	index := filepath.Join(dir, "index.jsonl")
+	if err := a.load(index); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(index, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	a.file = file
+	return a, nil
+}
+
+func (a *Archiver) load(index string) error {
+	file, err := os.Open(index)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		e := &ArchiveEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil || e.SHA256 == "" {
+			continue
+		}
+		// 内容文件已被删除的项重新归档
+		if _, err := os.Stat(a.blobPath(e.SHA256)); err != nil {
+			continue
+		}
+		a.add(e)
+	}
+	return scanner.Err()
+}
+
+func (a *Archiver) add(e *ArchiveEntry) {
+	a.entries = append(a.entries, e)
+	a.byKey[e.key()] = true
+	a.blobs[e.SHA256] = e.Size
+	a.paths[e.Path] = e.SHA256
+}
+
+func (a *Archiver) blobPath(sum string) string {
+	return filepath.Join(a.dir, "blobs", sum[:2], sum)
+}
+
+// Wants 判断是否归档该响应，sniffed 为响应体开头的识别结果
+func (a *Archiver) Wants(contentType, rawURL string, sniffed ContentClass) bool {
+	return a.kinds[ArchiveKind(contentType, rawURL, sniffed)]
+}
+
+// MaxSize 返回单个响应的归档大小上限
+func (a *Archiver) MaxSize() int64 {
+	return a.maxSize
+}
+
+// Save 归档一个响应，返回索引项和是否为新项，不需要归档时返回 nil
+func (a *Archiver) Save(rawURL, contentType string, data []byte) (*ArchiveEntry, bool, error) {
+	sniffed := SniffContent(data)
+	kind := ArchiveKind(contentType, rawURL, sniffed)
+	if !a.kinds[kind] || len(data) == 0 || int64(len(data)) > a.maxSize {
+		return nil, false, nil
+	}
+	hash := sha256.Sum256(data)
+	e := &ArchiveEntry{
+		SHA256:      hex.EncodeToString(hash[:]),
+		Size:        int64(len(data)),
+		Kind:        kind,
+		ContentType: contentType,
+		MIME:        sniffed.MIME,
+		URL:         rawURL,
+		Time:        time.Now(),
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.byKey[e.key()] {
+		return e, false, nil
+	}
+	blob := a.blobPath(e.SHA256)
+	if _, ok := a.blobs[e.SHA256]; !ok {
+		if err := writeFileAtomic(blob, data); err != nil {
+			return nil, false, err
+		}
+	}
+	e.Path = a.mirrorPath(rawURL, archiveExtension(kind, contentType, rawURL, sniffed), e.SHA256)
+	if err := a.mirror(blob, e.Path, data); err != nil {
+		return nil, false, err
+	}
+	a.add(e)
+	if line, err := json.Marshal(e); err == nil {
+		a.file.Write(append(line, '\n'))
+	}
+	return e, true, nil
+}
+
+// 镜像路径为 sites/主机/路径，目录地址使用 index，同一路径内容不同时在文件名后加哈希前缀
+func (a *Archiver) mirrorPath(rawURL, ext, sum string) string {
+	host, p := "unknown", "/"
+	if u, err := url.Parse(rawURL); err == nil {
+		host, p = u.Host, u.Path
+	}
+	host = strings.NewReplacer(":", "_", "/", "_", `\`, "_").Replace(host)
+	if host == "" {
+		host = "unknown"
+	}
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += "index"
+	}
+	var segments []string
+	for _, s := range strings.Split(path.Clean("/"+p), "/") {
+		if s = CleanPathReplace(s); s != "" && s != "." && s != ".." {
+			segments = append(segments, s)
+		}
+	}
+	if len(segments) == 0 {
+		segments = []string{"index"}
+	}
+	name := segments[len(segments)-1]
+	if path.Ext(name) == "" {
+		name += ext
+	}
+	dir := path.Join(append([]string{"sites", host}, segments[:len(segments)-1]...)...)
+	rel := path.Join(dir, name)
+	if existing, ok := a.paths[rel]; ok && existing != sum {
+		base := strings.TrimSuffix(name, path.Ext(name))
+		rel = path.Join(dir, base+"~"+sum[:8]+path.Ext(name))
+	}
+	return rel
+}
+
+// 镜像文件优先硬链接到内容文件，不支持时复制
+func (a *Archiver) mirror(blob, rel string, data []byte) error {
+	target := filepath.Join(a.dir, filepath.FromSlash(rel))
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.Link(blob, target); err == nil {
+		return nil
+	}
+	return writeFileAtomic(target, data)
+}
+
+// 先写临时文件再改名，避免留下写了一半的文件
+func writeFileAtomic(target string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(target+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(target+".tmp", target)
+}
+
+// 按文件头识别的扩展名优先，其次为地址中的扩展名、内容类型，最后按类别
+func archiveExtension(kind, contentType, rawURL string, sniffed ContentClass) string {
+	if sniffed.Ext != "" {
+		return sniffed.Ext
+	}
+	if ext := urlExt(rawURL); ext != "" {
+		return ext
+	}
+	ct := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	if ext, ok := archiveTypeExts[ct]; ok {
+		return ext
+	}
+	if ext, ok := archiveKindExts[kind]; ok {
+		return ext
+	}
+	return ".bin"
+}
+
+// List 返回归档索引，kind 为空时返回所有类别
+func (a *Archiver) List(kind string) []ArchiveEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var list []ArchiveEntry
+	for _, e := range a.entries {
+		if kind == "" || e.Kind == kind {
+			list = append(list, *e)
+		}
+	}
+	return list
+}
+
+// Open 按 SHA-256 打开归档的内容
+func (a *Archiver) Open(sum string) (io.ReadCloser, error) {
+	a.mu.RLock()
+	_, ok := a.blobs[sum]
+	a.mu.RUnlock()
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(a.blobPath(sum))
+}
+
+func (a *Archiver) Stats() ArchiveStats {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	stats := ArchiveStats{Entries: len(a.entries), Blobs: len(a.blobs)}
+	for _, size := range a.blobs {
+		stats.Bytes += size
+	}
+	return stats
+}
+
+func (a *Archiver) Sync() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Sync()
+}
@@ -0,0 +1,177 @@
+package fuzhu
+
+import (
+	"regexp"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopr/fuzhu/logger"
+)
+
+const (
+	// 规则默认的单次执行耗时预算
+	DefaultRuleBudget = 500 * time.Millisecond
+	// 规则默认只扫描不超过这个大小的内容
+	DefaultRuleMaxBodySize = 8 << 20
+	// 超出预算这么多次后降级
+	RuleDemoteAfter = 3
+	// 降级后的规则只扫描不超过这个大小的内容
+	DemotedRuleMaxBodySize = 64 << 10
+)
+
+// 单条规则的执行统计，并发更新
+type ruleStats struct {
+	calls      atomic.Int64
+	nanos      atomic.Int64
+	maxNanos   atomic.Int64
+	bytes      atomic.Int64
+	skipped    atomic.Int64 // 超过大小上限未扫描的次数
+	overBudget atomic.Int64
+	demoted    atomic.Bool
+}
+
+// 规则的执行统计
+type RuleProfile struct {
+	ID         int           `json:"id"`
+	Name       string        `json:"name"`
+	Calls      int64         `json:"calls"`
+	Total      time.Duration `json:"total"`
+	Max        time.Duration `json:"max"`
+	Avg        time.Duration `json:"avg"`
+	Bytes      int64         `json:"bytes"`
+	Skipped    int64         `json:"skipped"`
+	OverBudget int64         `json:"over_budget"`
+	Demoted    bool          `json:"demoted"`
+}
+
+// 规则对该大小的内容是否可以执行
+func (st *ruleStats) allow(rule *Rule, size int) bool {
+	limit := rule.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultRuleMaxBodySize
+	}
+	if st.demoted.Load() && limit > DemotedRuleMaxBodySize {
+		limit = DemotedRuleMaxBodySize
+	}
+	if size > limit {
+		st.skipped.Add(1)
+		return false
+	}
+	return true
+}
+
+// 记录一次执行，超出预算达到次数后降级并警告
+func (st *ruleStats) record(rule *Rule, size int, elapsed time.Duration) {
+	st.calls.Add(1)
+	st.nanos.Add(int64(elapsed))
+	st.bytes.Add(int64(size))
+	for {
+		max := st.maxNanos.Load()
+		if int64(elapsed) <= max || st.maxNanos.CompareAndSwap(max, int64(elapsed)) {
+			break
+		}
+	}
+
+	budget := rule.Budget
+	if budget <= 0 {
+		budget = DefaultRuleBudget
+	}
+	if elapsed <= budget {
+		return
+	}
+	if st.overBudget.Add(1) >= RuleDemoteAfter && st.demoted.CompareAndSwap(false, true) {
+		logger.Warnf("规则 %s 已 %d 次超出耗时预算 %s（本次 %s，%d 字节），降级为只扫描不超过 %d 字节的内容",
+			rule.Name, RuleDemoteAfter, budget, elapsed.Round(time.Millisecond), size, DemotedRuleMaxBodySize)
+	}
+}
+
+// Profile 返回所有规则的执行统计，按总耗时从高到低排序
+func (rm *RegexManager) Profile() []RuleProfile {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	list := make([]RuleProfile, 0, len(rm.rules))
+	for i, rule := range rm.rules {
+		st := rm.stats[i]
+		p := RuleProfile{
+			ID:         rule.ID,
+			Name:       rule.Name,
+			Calls:      st.calls.Load(),
+			Total:      time.Duration(st.nanos.Load()),
+			Max:        time.Duration(st.maxNanos.Load()),
+			Bytes:      st.bytes.Load(),
+			Skipped:    st.skipped.Load(),
+			OverBudget: st.overBudget.Load(),
+			Demoted:    st.demoted.Load(),
+		}
+		if p.Calls > 0 {
+			p.Avg = p.Total / time.Duration(p.Calls)
+		}
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Total > list[j].Total })
+	return list
+}
+
+// 规则快照，在锁内复制，在锁外执行；规则只会追加，统计可以并发更新
+type ruleSnapshot struct {
+	re    *regexp.Regexp
+	keyRe *regexp.Regexp
+	rule  Rule
+	stats *ruleStats
+}
+
+// 已启用的规则的快照
+func (rm *RegexManager) snapshot() []ruleSnapshot {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	rules := make([]ruleSnapshot, 0, len(rm.rules))
+	for i, rule := range rm.rules {
+		if rule.Enabled {
+			rules = append(rules, ruleSnapshot{re: rm.regexps[i], keyRe: rm.keyRegexps[i], rule: rule, stats: rm.stats[i]})
+		}
+	}
+	return rules
+}
+
+// 全进程同时执行的规则数不超过 CPU 数，计时不含等待调度的时间，忙时不会误降级
+var ruleSlots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+// 执行一次规则并计时，fn 在占用执行槽时运行
+func (sr ruleSnapshot) timed(size int, fn func()) {
+	ruleSlots <- struct{}{}
+	start := time.Now()
+	fn()
+	elapsed := time.Since(start)
+	<-ruleSlots
+	sr.stats.record(&sr.rule, size, elapsed)
+}
+
+// 用不超过 CPU 数的协程对每条规则执行 fn，结果按规则顺序合并
+func runRules(rules []ruleSnapshot, fn func(ruleSnapshot) []Match) []Match {
+	results := make([][]Match, len(rules))
+	workers := min(runtime.GOMAXPROCS(0), len(rules))
+	next := atomic.Int64{}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= len(rules) {
+					return
+				}
+				results[i] = fn(rules[i])
+			}
+		}()
+	}
+	wg.Wait()
+	var matches []Match
+	for _, r := range results {
+		matches = append(matches, r...)
+	}
+	return matches
+}
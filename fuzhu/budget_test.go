@@ -0,0 +1,94 @@
+package fuzhu
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func ruleProfile(t *testing.T, rm *RegexManager, name string) RuleProfile {
+	t.Helper()
+	for _, p := range rm.Profile() {
+		if p.Name == name {
+			return p
+		}
+	}
+	t.Fatalf("no profile for rule %s", name)
+	return RuleProfile{}
+}
+
+func TestRuleDemotion(t *testing.T) {
+	rm := newAWSManager(t)
+	// 每次执行都会超出 1ns 的预算
+	if err := rm.AddRule(Rule{Name: "slow", Pattern: `AKIA[0-9A-Z]{16}`, Budget: time.Nanosecond}); err != nil {
+		t.Fatal(err)
+	}
+	large := append(bytes.Repeat([]byte("x"), DemotedRuleMaxBodySize), testAWSKey...)
+	small := []byte(testAWSKey)
+
+	for i := 1; i <= RuleDemoteAfter; i++ {
+		if n := len(rm.MatchAll(large)); n != 2 {
+			t.Fatalf("call %d: %d matches, want 2", i, n)
+		}
+		if p := ruleProfile(t, rm, "slow"); p.Demoted != (i == RuleDemoteAfter) {
+			t.Fatalf("call %d: Demoted = %v", i, p.Demoted)
+		}
+	}
+
+	// 降级后只扫描小内容，其他规则不受影响
+	matches := rm.MatchAll(large)
+	if len(matches) != 1 || matches[0].Rule != "aws-access-key-id" {
+		t.Errorf("demoted rule still scans large bodies: %+v", matches)
+	}
+	if n := len(rm.MatchAll(small)); n != 2 {
+		t.Errorf("small body: %d matches, want 2", n)
+	}
+
+	p := ruleProfile(t, rm, "slow")
+	if p.Calls != RuleDemoteAfter+1 || p.Skipped != 1 || p.OverBudget != RuleDemoteAfter+1 || p.Max == 0 {
+		t.Errorf("slow profile = %+v", p)
+	}
+	if p := ruleProfile(t, rm, "aws-access-key-id"); p.Demoted || p.OverBudget != 0 || p.Calls != RuleDemoteAfter+2 {
+		t.Errorf("aws profile = %+v", p)
+	}
+}
+
+func TestRuleMaxBodySize(t *testing.T) {
+	rm := NewRegexManager()
+	if err := rm.AddRule(Rule{Name: "small-only", Pattern: `AKIA[0-9A-Z]{16}`, MaxBodySize: 32}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(rm.MatchAll([]byte(testAWSKey))); n != 1 {
+		t.Errorf("body under the limit: %d matches, want 1", n)
+	}
+	if n := len(rm.MatchAll([]byte(testAWSKey + " padding past the limit"))); n != 0 {
+		t.Errorf("body over the limit: %d matches, want 0", n)
+	}
+	if p := ruleProfile(t, rm, "small-only"); p.Calls != 1 || p.Skipped != 1 {
+		t.Errorf("profile = %+v", p)
+	}
+}
+
+func TestMatchAllRuleOrder(t *testing.T) {
+	rm := NewRegexManager()
+	var want []string
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("rule-%02d", i)
+		if err := rm.AddRule(Rule{Name: name, Pattern: `AKIA[0-9A-Z]{16}`}); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, name)
+	}
+	rm.SetRuleEnabled(rm.Rules()[10].ID, false)
+	want = slices.Delete(want, 10, 11)
+
+	var got []string
+	for _, m := range rm.MatchAll([]byte(testAWSKey)) {
+		got = append(got, m.Rule)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("rules = %v, want %v", got, want)
+	}
+}
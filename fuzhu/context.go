@@ -0,0 +1,212 @@
+package fuzhu
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// 脱敏方式
+const (
+	RedactNone    = "none"    // 不脱敏
+	RedactPartial = "partial" // 保留首尾几个字符
+	RedactFull    = "full"    // 全部替换
+)
+
+// 单行超过这个长度视为压缩过的代码
+const minifiedLineLength = 1000
+
+// 匹配上下文的选项
+type ContextOptions struct {
+	Before int    // 匹配前保留的字节数
+	After  int    // 匹配后保留的字节数
+	Redact string // 上下文和日志中密钥的脱敏方式
+}
+
+var DefaultContextOptions = ContextOptions{Before: 80, After: 80, Redact: RedactNone}
+
+// 匹配位置和前后内容
+type MatchContext struct {
+	Offset     int    `json:"offset"` // 字节偏移
+	Line       int    `json:"line"`   // 从1开始
+	Column     int    `json:"column"` // 从1开始，按字符计
+	Before     string `json:"before,omitempty"`
+	Value      string `json:"value"` // 按选项脱敏后的匹配内容
+	After      string `json:"after,omitempty"`
+	Minified   bool   `json:"minified,omitempty"`
+	PrettyLine int    `json:"pretty_line,omitempty"` // 压缩代码格式化后大约所在的行
+}
+
+// ExtractContext 根据匹配位置取出行列号和前后内容
+func ExtractContext(data []byte, m Match, opts ContextOptions) *MatchContext {
+	start, end := m.Index, m.Index+m.Length
+	if start < 0 || end > len(data) || start > end {
+		return nil
+	}
+	ctx := &MatchContext{Offset: start, Line: 1}
+
+	lineStart := 0
+	for i := 0; i < start; i++ {
+		if data[i] == '\n' {
+			ctx.Line++
+			lineStart = i + 1
+		}
+	}
+	ctx.Column = utf8.RuneCount(data[lineStart:start]) + 1
+
+	lineEnd := len(data)
+	if i := bytes.IndexByte(data[end:], '\n'); i != -1 {
+		lineEnd = end + i
+	}
+	if lineEnd-lineStart > minifiedLineLength {
+		ctx.Minified = true
+		ctx.PrettyLine = prettyLine(data[lineStart:start])
+	}
+
+	before := start - opts.Before
+	if before < 0 {
+		before = 0
+	}
+	after := end + opts.After
+	if after > len(data) {
+		after = len(data)
+	}
+	ctx.Before = validUTF8Suffix(data[before:start])
+	ctx.Value = redactWithin(string(data[start:end]), m.Secret, opts.Redact)
+	ctx.After = validUTF8Prefix(data[end:after])
+	return ctx
+}
+
+// Location 返回 行:列 形式的位置，压缩代码额外给出格式化后的行号
+func (c *MatchContext) Location() string {
+	if c.Minified {
+		return fmt.Sprintf("%d:%d (offset %d, ~pretty line %d)", c.Line, c.Column, c.Offset, c.PrettyLine)
+	}
+	return fmt.Sprintf("%d:%d", c.Line, c.Column)
+}
+
+// Snippet 返回单行的上下文片段，换行显示为 ⏎
+func (c *MatchContext) Snippet() string {
+	s := c.Before + "«" + c.Value + "»" + c.After
+	return strings.NewReplacer("\r\n", "⏎", "\n", "⏎", "\r", "⏎").Replace(s)
+}
+
+// RedactSecret 按方式对密钥脱敏
+func RedactSecret(secret, mode string) string {
+	switch mode {
+	case RedactFull:
+		return strings.Repeat("*", utf8.RuneCountInString(secret))
+	case RedactPartial:
+		r := []rune(secret)
+		keep := len(r) / 4
+		if keep > 4 {
+			keep = 4
+		}
+		if keep == 0 {
+			return strings.Repeat("*", len(r))
+		}
+		return string(r[:keep]) + strings.Repeat("*", len(r)-2*keep) + string(r[len(r)-keep:])
+	}
+	return secret
+}
+
+// 保存历史记录时需要脱敏的头部
+var SensitiveHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+	"X-Api-Key", "X-Auth-Token", "X-Csrf-Token", "X-Xsrf-Token",
+}
+
+// RedactHeaders 返回头部的副本，敏感头部按方式脱敏：Authorization 保留认证方式，Cookie 保留名称
+func RedactHeaders(h http.Header, mode string) http.Header {
+	c := h.Clone()
+	if c == nil || mode == "" || mode == RedactNone {
+		return c
+	}
+	for _, name := range SensitiveHeaders {
+		values := c[name]
+		for i, v := range values {
+			switch name {
+			case "Authorization", "Proxy-Authorization":
+				if scheme, cred, ok := strings.Cut(v, " "); ok {
+					values[i] = scheme + " " + RedactSecret(cred, mode)
+					continue
+				}
+				values[i] = RedactSecret(v, mode)
+			case "Cookie":
+				pairs := strings.Split(v, ";")
+				for j, pair := range pairs {
+					if k, val, ok := strings.Cut(pair, "="); ok {
+						pairs[j] = k + "=" + RedactSecret(val, mode)
+					}
+				}
+				values[i] = strings.Join(pairs, ";")
+			case "Set-Cookie":
+				pair, attrs, _ := strings.Cut(v, ";")
+				if k, val, ok := strings.Cut(pair, "="); ok {
+					pair = k + "=" + RedactSecret(val, mode)
+				}
+				if attrs != "" {
+					pair += ";" + attrs
+				}
+				values[i] = pair
+			default:
+				values[i] = RedactSecret(v, mode)
+			}
+		}
+	}
+	return c
+}
+
+// 只对完整匹配中的密钥部分脱敏
+func redactWithin(value, secret, mode string) string {
+	if mode == "" || mode == RedactNone || secret == "" {
+		return value
+	}
+	return strings.Replace(value, secret, RedactSecret(secret, mode), 1)
+}
+
+// 估算压缩代码格式化后的行号：语句和代码块的分隔符各占一行
+func prettyLine(line []byte) int {
+	n := 1
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'', '`':
+			quote = c
+		case ';', '{', '}':
+			n++
+		}
+	}
+	return n
+}
+
+// 截取上下文时去掉被切断的多字节字符
+func validUTF8Suffix(b []byte) string {
+	for len(b) > 0 && !utf8.RuneStart(b[0]) {
+		b = b[1:]
+	}
+	return string(b)
+}
+
+func validUTF8Prefix(b []byte) string {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				b = b[:i]
+			}
+			break
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,182 @@
+package fuzhu
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 默认解码层数，0 表示不解码
+const DefaultDecodeDepth = 2
+
+const (
+	// 每层最多尝试解码的候选数，防止大文件中候选过多
+	maxDecodeCandidates = 2000
+	// 一份数据所有解码结果的总大小上限，每个解码结果都要重新匹配全部规则
+	maxDecodedBytes = 4 << 20
+)
+
+// 解码后的一层数据
+type DecodedLayer struct {
+	Path string // 解码路径，由内到外，例如 base64>json>body
+	Data []byte
+}
+
+// 解码器：re 找出候选片段，为空时对整块数据解码
+type decoder struct {
+	name   string
+	re     *regexp.Regexp
+	decode func([]byte) ([]byte, bool)
+}
+
+var decoders = []decoder{
+	{"base64", regexp.MustCompile(`[A-Za-z0-9+/_-]{20,}={0,2}`), decodeBase64},
+	{"url", regexp.MustCompile(`[^\s"'<>()]*%[0-9A-Fa-f]{2}[^\s"'<>()]*`), decodeURL},
+	{"hex", regexp.MustCompile(`\b(?:[0-9a-fA-F]{2}){16,}\b`), decodeHex},
+	{"unicode", nil, decodeEscapes},
+	{"html", nil, decodeHTMLEntities},
+}
+
+// DecodeLayers 递归解码数据中的编码片段，返回所有解码结果（不含原始数据）
+func DecodeLayers(data []byte, depth int) []DecodedLayer {
+	var layers []DecodedLayer
+	seen := make(map[string]bool)
+	total := 0
+	current := []DecodedLayer{{Path: "body", Data: data}}
+	for d := 0; d < depth && len(current) > 0; d++ {
+		var next []DecodedLayer
+		for _, parent := range current {
+			container := parent.Path
+			if json.Valid(bytes.TrimSpace(parent.Data)) {
+				container = "json>" + container
+			}
+			for _, dec := range decoders {
+				for _, out := range dec.apply(parent.Data) {
+					key := string(out)
+					if seen[key] || total+len(out) > maxDecodedBytes {
+						continue
+					}
+					seen[key] = true
+					total += len(out)
+					next = append(next, DecodedLayer{Path: dec.name + ">" + container, Data: out})
+				}
+			}
+		}
+		layers = append(layers, next...)
+		current = next
+	}
+	return layers
+}
+
+func (d decoder) apply(data []byte) [][]byte {
+	if d.re == nil {
+		if out, ok := d.decode(data); ok {
+			return [][]byte{out}
+		}
+		return nil
+	}
+	var results [][]byte
+	for _, candidate := range d.re.FindAll(data, maxDecodeCandidates) {
+		if out, ok := d.decode(candidate); ok {
+			results = append(results, out)
+		}
+	}
+	return results
+}
+
+func decodeBase64(b []byte) ([]byte, bool) {
+	s := string(bytes.TrimRight(b, "="))
+	enc := base64.RawStdEncoding
+	if bytes.ContainsAny(b, "-_") {
+		enc = base64.RawURLEncoding
+	}
+	out, err := enc.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	return out, isPrintable(out)
+}
+
+func decodeURL(b []byte) ([]byte, bool) {
+	s, err := url.QueryUnescape(string(b))
+	if err != nil {
+		if s, err = url.PathUnescape(string(b)); err != nil {
+			return nil, false
+		}
+	}
+	return []byte(s), s != string(b)
+}
+
+func decodeHex(b []byte) ([]byte, bool) {
+	out := make([]byte, hex.DecodedLen(len(b)))
+	if _, err := hex.Decode(out, b); err != nil {
+		return nil, false
+	}
+	return out, isPrintable(out)
+}
+
+var (
+	escapeRe = regexp.MustCompile(`\\u\{[0-9a-fA-F]{1,6}\}|\\u[0-9a-fA-F]{4}|\\x[0-9a-fA-F]{2}|\\[0-7]{3}|\\["'/\\]`)
+	// JS 中到处都是 \" 和 \/，只有出现 \uXXXX、\xXX 这样的转义时才解码整块数据
+	escapeTriggerRe = regexp.MustCompile(`\\u\{[0-9a-fA-F]{1,6}\}|\\u[0-9a-fA-F]{4}|\\x[0-9a-fA-F]{2}`)
+)
+
+// 解码 JS/JSON 中的 \uXXXX、\u{X}、\xXX、八进制转义和转义的引号
+func decodeEscapes(b []byte) ([]byte, bool) {
+	if !escapeTriggerRe.Match(b) {
+		return nil, false
+	}
+	out := escapeRe.ReplaceAllFunc(b, func(m []byte) []byte {
+		var digits string
+		base := 16
+		switch {
+		case len(m) == 2:
+			return m[1:]
+		case bytes.HasPrefix(m, []byte(`\u{`)):
+			digits = string(m[3 : len(m)-1])
+		case m[1] == 'u' || m[1] == 'x':
+			digits = string(m[2:])
+		default:
+			digits, base = string(m[1:]), 8
+		}
+		n, err := strconv.ParseUint(digits, base, 32)
+		if err != nil || !utf8.ValidRune(rune(n)) {
+			return m
+		}
+		return []byte(string(rune(n)))
+	})
+	return out, true
+}
+
+// 只有出现数字实体 &#...; 时才解码整块数据，&amp; 这类命名实体在 HTML 中太常见
+var entityTriggerRe = regexp.MustCompile(`&#(?:[0-9]{1,7}|[xX][0-9a-fA-F]{1,6});`)
+
+func decodeHTMLEntities(b []byte) ([]byte, bool) {
+	if !entityTriggerRe.Match(b) {
+		return nil, false
+	}
+	s := html.UnescapeString(string(b))
+	return []byte(s), s != string(b)
+}
+
+// 解码结果需要是可读文本，过滤掉普通单词被误当作 base64/hex 的情况
+func isPrintable(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	total, printable := 0, 0
+	for _, r := range string(b) {
+		total++
+		if unicode.IsPrint(r) || unicode.IsSpace(r) {
+			printable++
+		}
+	}
+	return printable*10 >= total*9
+}
@@ -0,0 +1,363 @@
+package fuzhu
+
+import (
+	"bytes"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 端点来源
+const (
+	EndpointKindURL     = "url"     // 字符串中的URL或路径
+	EndpointKindHTML    = "html"    // href/src/action 等属性
+	EndpointKindFetch   = "fetch"   // fetch() 调用
+	EndpointKindAxios   = "axios"   // axios 调用
+	EndpointKindGraphQL = "graphql" // GraphQL 操作名
+)
+
+// 从响应中提取出的一个端点，URL 已按来源页面解析为绝对地址
+type ExtractedEndpoint struct {
+	URL       string
+	Method    string
+	Kind      string
+	Operation string // GraphQL 操作，例如 query GetUser
+}
+
+// 参考 LinkFinder 的规则，匹配引号中的URL和路径
+var linkPatterns = []*regexp.Regexp{
+	// 绝对地址和协议相对地址
+	regexp.MustCompile("[\"'`]((?:[a-zA-Z][a-zA-Z0-9+.-]{0,9}://|//)[^\"'`/\\s]+\\.[a-zA-Z]{2,}[^\"'`\\s]*)[\"'`]"),
+	// 以 / ./ ../ 开头的相对路径
+	regexp.MustCompile("[\"'`]((?:/|\\.\\./|\\./)[^\"'`><,;| *()%$^/\\\\\\[\\]\\s][^\"'`><,;|()\\s]*)[\"'`]"),
+	// 带扩展名的相对路径，例如 api/user.php?id=
+	regexp.MustCompile("[\"'`]([a-zA-Z0-9_\\-/]+/[a-zA-Z0-9_\\-/.]+\\.(?:[a-zA-Z]{1,4}|action)(?:[?#][^\"'`\\s]*)?)[\"'`]"),
+	// 没有扩展名的接口路径，例如 api/v1/users
+	regexp.MustCompile("[\"'`]([a-zA-Z0-9_\\-]+/[a-zA-Z0-9_\\-/]{3,}(?:[?#][^\"'`\\s]*)?)[\"'`]"),
+	// 单个文件名
+	regexp.MustCompile("[\"'`]([a-zA-Z0-9_\\-]+\\.(?:php|asp|aspx|jsp|json|action|html|js|txt|xml)(?:[?#][^\"'`\\s]*)?)[\"'`]"),
+}
+
+var (
+	htmlAttrRe = regexp.MustCompile(`(?i)\b(?:href|src|action|formaction|data-url|data-src)\s*=\s*["']([^"'#\s][^"']*)["']`)
+	fetchRe    = regexp.MustCompile("\\bfetch\\(\\s*[\"'`]([^\"'`]+)[\"'`](?:\\s*,\\s*\\{[^}]{0,300}?\\bmethod\\s*:\\s*[\"'`](\\w+)[\"'`])?")
+	axiosRe    = regexp.MustCompile("\\baxios(?:\\.(get|post|put|delete|patch|head|options))?\\(\\s*[\"'`]([^\"'`]+)[\"'`]")
+	axiosCfgRe = regexp.MustCompile("\\baxios(?:\\.request)?\\(\\s*\\{[^}]{0,300}?\\burl\\s*:\\s*[\"'`]([^\"'`]+)[\"'`]")
+	methodRe   = regexp.MustCompile("\\bmethod\\s*:\\s*[\"'`](\\w+)[\"'`]")
+	graphqlRe  = regexp.MustCompile(`\b(query|mutation|subscription)\s+([A-Za-z_][A-Za-z0-9_]*)\s*[({]`)
+	templateRe = regexp.MustCompile(`\$\{\s*(?:[^{}]*?\.)?([A-Za-z_$][A-Za-z0-9_$]*)\s*\}`)
+	mimeRe     = regexp.MustCompile(`^(?:text|application|image|audio|video|font|multipart|model)/[a-zA-Z0-9.+-]+$`)
+)
+
+// IsEndpointSource 判断响应是否为需要提取端点的 JS 或 HTML
+func IsEndpointSource(contentType, rawURL string) bool {
+	ct := strings.ToLower(contentType)
+	if strings.Contains(ct, "javascript") || strings.Contains(ct, "ecmascript") || strings.Contains(ct, "html") {
+		return true
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		switch path.Ext(u.Path) {
+		case ".js", ".mjs", ".html", ".htm":
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractEndpoints 从 JS/HTML 中提取URL、接口路径、fetch/axios 调用和 GraphQL 操作名
+func ExtractEndpoints(data []byte, source string) []ExtractedEndpoint {
+	base, err := url.Parse(source)
+	if err != nil {
+		return nil
+	}
+	var list []ExtractedEndpoint
+	seen := make(map[string]bool)
+	add := func(raw, method, kind, operation string) {
+		resolved := resolveEndpoint(base, raw)
+		if resolved == "" && operation == "" {
+			return
+		}
+		method = strings.ToUpper(method)
+		key := method + " " + resolved + " " + operation
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		list = append(list, ExtractedEndpoint{URL: resolved, Method: method, Kind: kind, Operation: operation})
+	}
+
+	// 先提取调用点，带上请求方法
+	for _, m := range fetchRe.FindAllSubmatch(data, -1) {
+		add(string(m[1]), string(m[2]), EndpointKindFetch, "")
+	}
+	for _, m := range axiosRe.FindAllSubmatch(data, -1) {
+		add(string(m[2]), string(m[1]), EndpointKindAxios, "")
+	}
+	for _, loc := range axiosCfgRe.FindAllSubmatchIndex(data, -1) {
+		// method 可能在 url 前后，在整个配置对象中查找
+		obj := data[loc[0]:]
+		if end := bytes.IndexByte(obj, '}'); end != -1 {
+			obj = obj[:end]
+		}
+		method := ""
+		if mm := methodRe.FindSubmatch(obj); mm != nil {
+			method = string(mm[1])
+		}
+		add(string(data[loc[2]:loc[3]]), method, EndpointKindAxios, "")
+	}
+	for _, m := range htmlAttrRe.FindAllSubmatch(data, -1) {
+		add(string(m[1]), "", EndpointKindHTML, "")
+	}
+	for _, re := range linkPatterns {
+		for _, m := range re.FindAllSubmatch(data, -1) {
+			add(string(m[1]), "", EndpointKindURL, "")
+		}
+	}
+	for _, m := range graphqlRe.FindAllSubmatch(data, -1) {
+		add("", "POST", EndpointKindGraphQL, string(m[1])+" "+string(m[2]))
+	}
+
+	// 已经作为调用点提取过的URL不再重复记录为普通URL
+	called := make(map[string]bool)
+	for _, e := range list {
+		if e.Kind == EndpointKindFetch || e.Kind == EndpointKindAxios {
+			called[e.URL] = true
+		}
+	}
+	result := list[:0]
+	for _, e := range list {
+		if (e.Kind == EndpointKindURL || e.Kind == EndpointKindHTML) && called[e.URL] {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// 把提取到的字符串解析为绝对地址，模板变量转为 {name}，无效时返回空
+func resolveEndpoint(base *url.URL, raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || mimeRe.MatchString(raw) || strings.ContainsAny(raw, " \t\r\n<>") {
+		return ""
+	}
+	lower := strings.ToLower(raw)
+	for _, prefix := range []string{"javascript:", "data:", "mailto:", "tel:", "about:", "blob:"} {
+		if strings.HasPrefix(lower, prefix) {
+			return ""
+		}
+	}
+	raw = templateRe.ReplaceAllString(raw, "{$1}")
+	// 保留路径参数的大括号
+	escaped := strings.NewReplacer("{", "%7B", "}", "%7D").Replace(raw)
+	u, err := url.Parse(escaped)
+	if err != nil {
+		return ""
+	}
+	u = base.ResolveReference(u)
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "ws" && u.Scheme != "wss" {
+		return ""
+	}
+	u.Fragment = ""
+	return strings.NewReplacer("%7B", "{", "%7D", "}").Replace(u.String())
+}
+
+// 端点清单中的一项，按主机、方法和路径去重
+type Endpoint struct {
+	Scheme     string    `json:"scheme"`
+	Host       string    `json:"host"`
+	Method     string    `json:"method,omitempty"` // 为空表示未知
+	Path       string    `json:"path"`
+	Params     []string  `json:"params,omitempty"`     // 查询参数名
+	Kinds      []string  `json:"kinds"`                // 提取方式
+	Operations []string  `json:"operations,omitempty"` // GraphQL 操作
+	Source     string    `json:"source"`               // 首次发现的页面
+	FirstSeen  time.Time `json:"first_seen"`
+	Hits       int       `json:"hits"`
+}
+
+// 按主机去重的端点清单
+type EndpointInventory struct {
+	endpoints map[string]*Endpoint
+	mu        sync.RWMutex
+}
+
+func NewEndpointInventory() *EndpointInventory {
+	return &EndpointInventory{endpoints: make(map[string]*Endpoint)}
+}
+
+// Add 记录从 source 页面提取到的端点，返回新增的数量
+// GraphQL 操作没有地址，记录在来源页面主机的 /graphql 下
+func (inv *EndpointInventory) Add(source string, list []ExtractedEndpoint) int {
+	src, err := url.Parse(source)
+	if err != nil {
+		return 0
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	added := 0
+	for _, e := range list {
+		u := &url.URL{Scheme: src.Scheme, Host: src.Host, Path: "/graphql"}
+		if e.URL != "" {
+			if u, err = url.Parse(e.URL); err != nil {
+				continue
+			}
+		}
+		p := u.Path
+		if p == "" {
+			p = "/"
+		}
+		key := u.Host + " " + e.Method + " " + p
+		ep, ok := inv.endpoints[key]
+		if !ok {
+			ep = &Endpoint{Scheme: u.Scheme, Host: u.Host, Method: e.Method, Path: p, Source: source, FirstSeen: time.Now()}
+			inv.endpoints[key] = ep
+			added++
+		}
+		ep.Hits++
+		ep.Kinds = appendUnique(ep.Kinds, e.Kind)
+		for name := range u.Query() {
+			ep.Params = appendUnique(ep.Params, name)
+		}
+		if e.Operation != "" {
+			ep.Operations = appendUnique(ep.Operations, e.Operation)
+		}
+	}
+	return added
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, s := range list {
+		if s == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// List 返回端点，host 为空时返回全部，按主机和路径排序
+func (inv *EndpointInventory) List(host string) []Endpoint {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	list := make([]Endpoint, 0, len(inv.endpoints))
+	for _, ep := range inv.endpoints {
+		if host == "" || ep.Host == host {
+			list = append(list, *ep)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Host != list[j].Host {
+			return list[i].Host < list[j].Host
+		}
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return list[i].Method < list[j].Method
+	})
+	return list
+}
+
+// Hosts 返回清单中的主机及端点数量
+func (inv *EndpointInventory) Hosts() map[string]int {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	hosts := make(map[string]int)
+	for _, ep := range inv.endpoints {
+		hosts[ep.Host]++
+	}
+	return hosts
+}
+
+func (inv *EndpointInventory) Count() int {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	return len(inv.endpoints)
+}
+
+// Wordlist 导出路径字典，每个路径片段和完整路径各一行
+func Wordlist(list []Endpoint) []string {
+	seen := make(map[string]bool)
+	var words []string
+	add := func(w string) {
+		if w != "" && !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	for _, ep := range list {
+		add(ep.Path)
+	}
+	for _, ep := range list {
+		for _, seg := range strings.Split(ep.Path, "/") {
+			if !strings.HasPrefix(seg, "{") {
+				add(seg)
+			}
+		}
+		for _, p := range ep.Params {
+			add(p)
+		}
+	}
+	return words
+}
+
+var pathParamRe = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// OpenAPI 导出 OpenAPI 3 骨架，未知方法按 GET 处理
+func OpenAPI(host string, list []Endpoint) map[string]interface{} {
+	paths := make(map[string]map[string]interface{})
+	servers := make(map[string]bool)
+	for _, ep := range list {
+		if host != "" && ep.Host != host {
+			continue
+		}
+		servers[ep.Scheme+"://"+ep.Host] = true
+		method := strings.ToLower(ep.Method)
+		if method == "" {
+			method = "get"
+		}
+		var params []map[string]interface{}
+		for _, m := range pathParamRe.FindAllStringSubmatch(ep.Path, -1) {
+			params = append(params, map[string]interface{}{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]string{"type": "string"},
+			})
+		}
+		for _, name := range ep.Params {
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "query", "schema": map[string]string{"type": "string"},
+			})
+		}
+		op := map[string]interface{}{
+			"summary":   "found in " + ep.Source,
+			"responses": map[string]interface{}{"default": map[string]string{"description": "unknown"}},
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if len(ep.Operations) > 0 {
+			op["x-graphql-operations"] = ep.Operations
+		}
+		if paths[ep.Path] == nil {
+			paths[ep.Path] = make(map[string]interface{})
+		}
+		paths[ep.Path][method] = op
+	}
+
+	serverList := make([]map[string]string, 0, len(servers))
+	for s := range servers {
+		serverList = append(serverList, map[string]string{"url": s})
+	}
+	sort.Slice(serverList, func(i, j int) bool { return serverList[i]["url"] < serverList[j]["url"] })
+	title := host
+	if title == "" {
+		title = "gopr endpoints"
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]string{"title": title, "version": "0.0.0"},
+		"servers": serverList,
+		"paths":   paths,
+	}
+}
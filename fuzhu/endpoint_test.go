@@ -0,0 +1,99 @@
+package fuzhu
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+const testEndpointJS = `
+fetch("/api/v1/users", { headers: h, method: "POST" });
+axios.delete('/api/v1/users/' + id);
+axios({ method: 'put', url: "/api/v1/orders" });
+const u = ` + "`/api/v1/users/${user.id}/avatar`" + `;
+const cdn = "https://cdn.example.com/lib.js";
+const rel = "./config.json";
+const type = "application/json";
+const js = "javascript:void(0)";
+const q = gql` + "`query GetUser($id: ID!) { user(id: $id) { name } }`" + `;
+`
+
+func TestExtractEndpoints(t *testing.T) {
+	got := make(map[string]string)
+	for _, e := range ExtractEndpoints([]byte(testEndpointJS), "https://app.example.com/static/app.js") {
+		got[e.Method+" "+e.URL+" "+e.Operation] = e.Kind
+	}
+	want := map[string]string{
+		"POST https://app.example.com/api/v1/users ":         EndpointKindFetch,
+		"DELETE https://app.example.com/api/v1/users/ ":      EndpointKindAxios,
+		"PUT https://app.example.com/api/v1/orders ":         EndpointKindAxios,
+		" https://app.example.com/api/v1/users/{id}/avatar ": EndpointKindURL,
+		" https://cdn.example.com/lib.js ":                   EndpointKindURL,
+		" https://app.example.com/static/config.json ":       EndpointKindURL,
+		"POST  query GetUser":                                EndpointKindGraphQL,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("ExtractEndpoints =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestExtractEndpointsHTML(t *testing.T) {
+	html := `<a href="/login?next=/">x</a><form action="search.php"></form><a href="#top">t</a><a href="mailto:a@b.c">m</a><img src="data:image/png;base64,AAAA">`
+	var got []string
+	for _, e := range ExtractEndpoints([]byte(html), "https://app.example.com/index.html") {
+		got = append(got, e.Kind+" "+e.URL)
+	}
+	want := []string{
+		"html https://app.example.com/login?next=/",
+		"html https://app.example.com/search.php",
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("ExtractEndpoints = %v, want %v", got, want)
+	}
+}
+
+func TestEndpointInventory(t *testing.T) {
+	inv := NewEndpointInventory()
+	source := "https://app.example.com/static/app.js"
+	list := ExtractEndpoints([]byte(testEndpointJS), source)
+	if added := inv.Add(source, list); added != len(list) {
+		t.Errorf("first Add = %d, want %d", added, len(list))
+	}
+	if added := inv.Add(source, list); added != 0 {
+		t.Errorf("second Add = %d, want 0", added)
+	}
+	if added := inv.Add(source, []ExtractedEndpoint{{URL: "https://app.example.com/api/v1/orders?page=2", Method: "PUT", Kind: EndpointKindURL}}); added != 0 {
+		t.Errorf("query string created a new endpoint")
+	}
+
+	hosts := inv.Hosts()
+	if hosts["app.example.com"] != len(list)-1 || hosts["cdn.example.com"] != 1 {
+		t.Errorf("Hosts = %v", hosts)
+	}
+	var orders, graphql Endpoint
+	for _, ep := range inv.List("app.example.com") {
+		switch ep.Path {
+		case "/api/v1/orders":
+			orders = ep
+		case "/graphql":
+			graphql = ep
+		}
+	}
+	if orders.Hits != 3 || !slices.Equal(orders.Params, []string{"page"}) || !slices.Equal(orders.Kinds, []string{EndpointKindAxios, EndpointKindURL}) {
+		t.Errorf("orders = %+v", orders)
+	}
+	if !slices.Equal(graphql.Operations, []string{"query GetUser"}) || graphql.Method != "POST" {
+		t.Errorf("graphql = %+v", graphql)
+	}
+
+	words := Wordlist(inv.List("app.example.com"))
+	for _, w := range []string{"/api/v1/users/{id}/avatar", "api", "v1", "avatar", "page"} {
+		if !slices.Contains(words, w) {
+			t.Errorf("Wordlist missing %q: %v", w, words)
+		}
+	}
+	if slices.Contains(words, "{id}") {
+		t.Errorf("Wordlist contains path parameter: %v", words)
+	}
+}
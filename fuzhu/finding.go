@@ -0,0 +1,217 @@
+package fuzhu
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrFindingNotFound = errors.New("finding not found")
+
+// 一条扫描结果，同一主机上同一规则匹配到的同一个值只保存一次
+type Finding struct {
+	ID            int64              `json:"id"`
+	Time          time.Time          `json:"time"`
+	LastSeen      time.Time          `json:"last_seen"`
+	Hits          int                `json:"hits"`
+	ExchangeID    int64              `json:"exchange_id,omitempty"`
+	Method        string             `json:"method"`
+	URL           string             `json:"url"`
+	Host          string             `json:"host"`
+	Rule          string             `json:"rule"`
+	Severity      string             `json:"severity"`
+	Value         string             `json:"value"`                // 按 -redact 脱敏后的值
+	ValueHash     string             `json:"value_hash,omitempty"` // 原始值的哈希，脱敏后仍可据此去重
+	FalsePositive bool               `json:"false_positive,omitempty"`
+	Validations   []ValidationResult `json:"validations,omitempty"`
+	Token         *TokenInfo         `json:"token,omitempty"`
+	Context       *MatchContext      `json:"context,omitempty"`     // 首次发现时的位置和上下文
+	Decoding      string             `json:"decoding,omitempty"`    // 解码路径，位置相对于解码后的数据
+	SourceFile    string             `json:"source_file,omitempty"` // 从 source map 还原的源文件，位置相对于该文件
+	Path          string             `json:"path,omitempty"`        // JSON pointer 或 XPath，位置相对于该值
+}
+
+// 旧记录没有保存哈希，按原始值计算
+func (f *Finding) key() string {
+	hash := f.ValueHash
+	if hash == "" {
+		hash = SecretHash(f.Value)
+	}
+	return f.Rule + "\x00" + f.Host + "\x00" + hash
+}
+
+// SecretHash 返回密钥的 SHA-256 前 16 个十六进制字符，用于在不保存原文时去重
+func SecretHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+// 结果存储，新结果追加写入 jsonl 文件，重复命中的次数在 Sync 时追加更新记录。
+// 同一结果会出现多次，以最后一条为准；外部工具读取的是 logger 的扫描结果事件日志
+type FindingStore struct {
+	path     string
+	file     *os.File
+	findings []*Finding
+	byKey    map[string]*Finding
+	byID     map[int64]*Finding
+	dirty    map[int64]bool // 重复命中后尚未写入文件的结果
+	nextID   int64
+	mu       sync.RWMutex
+}
+
+func NewFindingStore(path string) (*FindingStore, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	fs := &FindingStore{
+		path:  path,
+		byKey: make(map[string]*Finding),
+		byID:  make(map[int64]*Finding),
+		dirty: make(map[int64]bool),
+	}
+	if err := fs.load(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fs.file = file
+	return fs, nil
+}
+
+func (fs *FindingStore) load() error {
+	file, err := os.Open(fs.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		f := &Finding{}
+		if err := json.Unmarshal(scanner.Bytes(), f); err != nil {
+			continue
+		}
+		// 同一ID出现多次时以最后一次为准
+		if old, ok := fs.byID[f.ID]; ok {
+			*old = *f
+			continue
+		}
+		fs.insert(f)
+		if f.ID > fs.nextID {
+			fs.nextID = f.ID
+		}
+	}
+	return scanner.Err()
+}
+
+func (fs *FindingStore) insert(f *Finding) {
+	fs.findings = append(fs.findings, f)
+	fs.byKey[f.key()] = f
+	fs.byID[f.ID] = f
+}
+
+// Add 保存一条结果，返回保存后的结果的副本以及是否为新结果
+func (fs *FindingStore) Add(f *Finding) (*Finding, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if existing, ok := fs.byKey[f.key()]; ok {
+		existing.Hits++
+		existing.LastSeen = f.Time
+		fs.dirty[existing.ID] = true
+		copied := *existing
+		return &copied, false
+	}
+	fs.nextID++
+	f.ID = fs.nextID
+	f.Hits = 1
+	f.LastSeen = f.Time
+	fs.insert(f)
+	fs.append(f)
+	copied := *f
+	return &copied, true
+}
+
+// 需持有锁
+func (fs *FindingStore) append(f *Finding) {
+	delete(fs.dirty, f.ID)
+	if fs.file == nil {
+		return
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return
+	}
+	fs.file.Write(append(data, '\n'))
+}
+
+// SetFalsePositive 标记或取消误报，追加写入更新后的记录
+func (fs *FindingStore) SetFalsePositive(id int64, fp bool) (*Finding, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, ok := fs.byID[id]
+	if !ok {
+		return nil, ErrFindingNotFound
+	}
+	f.FalsePositive = fp
+	fs.append(f)
+	copied := *f
+	return &copied, nil
+}
+
+func (fs *FindingStore) Get(id int64) (*Finding, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	f, ok := fs.byID[id]
+	if !ok {
+		return nil, ErrFindingNotFound
+	}
+	copied := *f
+	return &copied, nil
+}
+
+// List 按发现顺序返回所有结果的副本
+func (fs *FindingStore) List() []Finding {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	list := make([]Finding, 0, len(fs.findings))
+	for _, f := range fs.findings {
+		list = append(list, *f)
+	}
+	return list
+}
+
+func (fs *FindingStore) Count() int {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return len(fs.findings)
+}
+
+// Sync 追加写入重复命中后更新了次数的结果，加载时同一ID以最后一条为准
+func (fs *FindingStore) Sync() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, f := range fs.findings {
+		if fs.dirty[f.ID] {
+			fs.append(f)
+		}
+	}
+	if fs.file == nil {
+		return nil
+	}
+	return fs.file.Sync()
+}
@@ -0,0 +1,277 @@
+package fuzhu
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 收集的信息类型
+const (
+	HarvestSubdomain    = "subdomain"     // 范围内主域名下的主机名
+	HarvestInternalIP   = "internal-ip"   // 内网、回环、链路本地地址
+	HarvestInternalHost = "internal-host" // .local/.internal/.corp 等内部域名
+	HarvestBucket       = "bucket"        // 云存储桶，值为 服务:桶名
+	HarvestEmail        = "email"
+)
+
+var HarvestKinds = []string{HarvestSubdomain, HarvestInternalIP, HarvestInternalHost, HarvestBucket, HarvestEmail}
+
+// 从数据中提取出的一项
+type Harvested struct {
+	Kind  string
+	Value string
+}
+
+var (
+	hostnameRe = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,24}\b`)
+	ipv4Re     = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`)
+	emailRe    = regexp.MustCompile(`\b[A-Za-z0-9._%+-]{1,64}@(?:[A-Za-z0-9-]+\.)+[A-Za-z]{2,24}\b`)
+
+	// 100.64.0.0/10 运营商级 NAT，常用于内部网络
+	cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+	internalSuffixes = []string{".local", ".localdomain", ".internal", ".intranet", ".corp", ".lan", ".home.arpa", ".svc.cluster.local"}
+
+	// 看起来像邮箱但其实是文件名，例如 logo@2x.png
+	emailFileTLDs = map[string]bool{"png": true, "jpg": true, "jpeg": true, "gif": true, "svg": true, "webp": true, "js": true, "css": true, "ico": true}
+)
+
+// 各云厂商的存储桶地址
+var bucketPatterns = []struct {
+	service string
+	re      *regexp.Regexp
+}{
+	{"s3", regexp.MustCompile(`(?i)\b([a-z0-9][a-z0-9.-]{1,61}[a-z0-9])\.s3(?:[.-](?:dualstack\.)?[a-z0-9-]+)?\.amazonaws\.com(?:\.cn)?\b`)},
+	{"s3", regexp.MustCompile(`(?i)(?:^|[^a-z0-9.-])s3(?:[.-][a-z0-9-]+)?\.amazonaws\.com(?:\.cn)?/([a-z0-9][a-z0-9.-]{1,61}[a-z0-9])\b`)},
+	{"s3", regexp.MustCompile(`(?i)\bs3://([a-z0-9][a-z0-9.-]{1,61}[a-z0-9])\b`)},
+	{"gcs", regexp.MustCompile(`(?i)(?:^|[^a-z0-9.-])storage\.(?:googleapis|cloud\.google)\.com/([a-z0-9][a-z0-9._-]{1,61}[a-z0-9])\b`)},
+	{"gcs", regexp.MustCompile(`(?i)\b([a-z0-9][a-z0-9._-]{1,61}[a-z0-9])\.storage\.googleapis\.com\b`)},
+	{"gcs", regexp.MustCompile(`(?i)\bgs://([a-z0-9][a-z0-9._-]{1,61}[a-z0-9])\b`)},
+	{"azure", regexp.MustCompile(`(?i)\b([a-z0-9]{3,24})\.blob\.core\.windows\.net\b`)},
+	{"oss", regexp.MustCompile(`(?i)\b([a-z0-9][a-z0-9-]{1,61}[a-z0-9])\.oss-[a-z0-9-]+\.aliyuncs\.com\b`)},
+	{"cos", regexp.MustCompile(`(?i)\b([a-z0-9][a-z0-9-]*-\d{6,})\.cos\.[a-z0-9-]+\.myqcloud\.com\b`)},
+}
+
+// Harvest 从数据中提取主机名、内网地址、存储桶和邮箱，
+// inScope 判断主机名是否属于范围内的主域名
+func Harvest(data []byte, inScope func(host string) bool) []Harvested {
+	var list []Harvested
+	seen := make(map[Harvested]bool)
+	add := func(kind, value string) {
+		h := Harvested{Kind: kind, Value: value}
+		if !seen[h] {
+			seen[h] = true
+			list = append(list, h)
+		}
+	}
+
+	for _, b := range bucketPatterns {
+		for _, m := range b.re.FindAllSubmatch(data, -1) {
+			add(HarvestBucket, b.service+":"+strings.ToLower(string(m[1])))
+		}
+	}
+	for _, m := range emailRe.FindAll(data, -1) {
+		email := strings.ToLower(string(m))
+		if emailFileTLDs[email[strings.LastIndexByte(email, '.')+1:]] {
+			continue
+		}
+		add(HarvestEmail, email)
+	}
+	for _, m := range ipv4Re.FindAll(data, -1) {
+		if ip := net.ParseIP(string(m)); ip != nil && isInternalIP(ip) {
+			add(HarvestInternalIP, ip.String())
+		}
+	}
+	for _, loc := range hostnameRe.FindAllIndex(data, -1) {
+		host := strings.ToLower(string(data[loc[0]:loc[1]]))
+		if isInternalHost(host) {
+			if internalHostAt(data, loc[0], loc[1]) {
+				add(HarvestInternalHost, host)
+			}
+		} else if inScope != nil && inScope(host) {
+			add(HarvestSubdomain, host)
+		}
+	}
+	return list
+}
+
+func isInternalIP(ip net.IP) bool {
+	if ip.IsUnspecified() {
+		return false
+	}
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || cgnatNet.Contains(ip)
+}
+
+func isInternalHost(host string) bool {
+	for _, suffix := range internalSuffixes {
+		if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 压缩后的 JS 中常见的对象名，e.local、this.internal 这样的属性访问不是主机名
+var jsReceivers = map[string]bool{
+	"this": true, "self": true, "window": true, "document": true, "global": true, "globalthis": true,
+	"process": true, "module": true, "exports": true, "props": true, "state": true, "options": true,
+	"config": true, "settings": true, "env": true, "data": true, "params": true,
+}
+
+// 判断 data[start:end] 处的内部域名是否真的是主机名：后缀前的每一级至少两个字符且不是常见的对象名；
+// 只有一级且不含数字或连字符时 (如 gitlab.internal) 还要求出现在 URL、邮箱或 host:port 中
+func internalHostAt(data []byte, start, end int) bool {
+	host := strings.ToLower(string(data[start:end]))
+	for _, suffix := range internalSuffixes {
+		if !strings.HasSuffix(host, suffix) || len(host) == len(suffix) {
+			continue
+		}
+		labels := strings.Split(strings.TrimSuffix(host, suffix), ".")
+		for _, label := range labels {
+			if len(label) < 2 || jsReceivers[label] {
+				return false
+			}
+		}
+		if len(labels) >= 2 || strings.ContainsAny(labels[0], "0123456789-") {
+			return true
+		}
+		before := string(data[max(0, start-2):start])
+		after := ""
+		if end < len(data) {
+			after = string(data[end : end+1])
+		}
+		return strings.HasSuffix(before, "//") || strings.HasSuffix(before, "@") || after == ":" || after == "/"
+	}
+	return false
+}
+
+// 收集到的一项，按项目、类型和值去重
+type HarvestItem struct {
+	Engagement string    `json:"engagement"`
+	Kind       string    `json:"kind"`
+	Value      string    `json:"value"`
+	FirstSeen  time.Time `json:"first_seen"`
+	FirstURL   string    `json:"first_url"`
+	LastSeen   time.Time `json:"last_seen"`
+	Hits       int       `json:"hits"`
+}
+
+func (h *HarvestItem) key() string {
+	return h.Engagement + "\x00" + h.Kind + "\x00" + h.Value
+}
+
+// 收集结果存储，新项追加写入 jsonl 文件
+type HarvestStore struct {
+	file  *os.File
+	items []*HarvestItem
+	byKey map[string]*HarvestItem
+	mu    sync.RWMutex
+}
+
+func NewHarvestStore(path string) (*HarvestStore, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	hs := &HarvestStore{byKey: make(map[string]*HarvestItem)}
+	if err := hs.load(path); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	hs.file = file
+	return hs, nil
+}
+
+func (hs *HarvestStore) load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		item := &HarvestItem{}
+		if err := json.Unmarshal(scanner.Bytes(), item); err != nil {
+			continue
+		}
+		if _, ok := hs.byKey[item.key()]; !ok {
+			hs.items = append(hs.items, item)
+			hs.byKey[item.key()] = item
+		}
+	}
+	return scanner.Err()
+}
+
+// Add 记录在 url 中发现的内容，返回新发现的项
+func (hs *HarvestStore) Add(engagement, url string, list []Harvested) []HarvestItem {
+	now := time.Now()
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	var added []HarvestItem
+	for _, h := range list {
+		item := &HarvestItem{Engagement: engagement, Kind: h.Kind, Value: h.Value}
+		if existing, ok := hs.byKey[item.key()]; ok {
+			existing.Hits++
+			existing.LastSeen = now
+			continue
+		}
+		item.FirstSeen, item.LastSeen, item.FirstURL, item.Hits = now, now, url, 1
+		hs.items = append(hs.items, item)
+		hs.byKey[item.key()] = item
+		if data, err := json.Marshal(item); err == nil && hs.file != nil {
+			hs.file.Write(append(data, '\n'))
+		}
+		added = append(added, *item)
+	}
+	return added
+}
+
+// List 返回项目中的收集结果，kind 为空时返回所有类型，按类型和值排序
+func (hs *HarvestStore) List(engagement, kind string) []HarvestItem {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+	var list []HarvestItem
+	for _, item := range hs.items {
+		if item.Engagement == engagement && (kind == "" || item.Kind == kind) {
+			list = append(list, *item)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Kind != list[j].Kind {
+			return list[i].Kind < list[j].Kind
+		}
+		return list[i].Value < list[j].Value
+	})
+	return list
+}
+
+func (hs *HarvestStore) Count() int {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+	return len(hs.items)
+}
+
+func (hs *HarvestStore) Sync() error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.file == nil {
+		return nil
+	}
+	return hs.file.Sync()
+}
@@ -0,0 +1,368 @@
+package fuzhu
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopr/fuzhu/logger"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrExchangeNotFound = errors.New("exchange not found")
+
+// 一次完整的请求/响应
+type Exchange struct {
+	ID            int64       `json:"id"`
+	Time          time.Time   `json:"time"`
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	Host          string      `json:"host"`
+	RequestHeader http.Header `json:"request_header"`
+	RequestBody   []byte      `json:"request_body,omitempty"`
+	// 请求体过大，只保存了开头，不能直接重放
+	RequestBodyTruncated bool            `json:"request_body_truncated,omitempty"`
+	StatusCode           int             `json:"status_code"`
+	ResponseHeader       http.Header     `json:"response_header"`
+	ResponseBody         []byte          `json:"response_body,omitempty"`
+	Duration             time.Duration   `json:"duration"`
+	ReplayOf             int64           `json:"replay_of,omitempty"` // 重放来源的ID
+	Metadata             []MetadataField `json:"metadata,omitempty"`  // 从响应的图片或文档中提取的元数据
+}
+
+// 历史记录索引项，不含请求和响应内容
+type ExchangeSummary struct {
+	ID          int64         `json:"id"`
+	Time        time.Time     `json:"time"`
+	Method      string        `json:"method"`
+	URL         string        `json:"url"`
+	Host        string        `json:"host"`
+	StatusCode  int           `json:"status_code"`
+	ContentType string        `json:"content_type"`
+	Length      int           `json:"length"`
+	Duration    time.Duration `json:"duration"`
+	ReplayOf    int64         `json:"replay_of,omitempty"`
+}
+
+func (ex *Exchange) Summary() ExchangeSummary {
+	return ExchangeSummary{
+		ID:          ex.ID,
+		Time:        ex.Time,
+		Method:      ex.Method,
+		URL:         ex.URL,
+		Host:        ex.Host,
+		StatusCode:  ex.StatusCode,
+		ContentType: ex.ResponseHeader.Get("Content-Type"),
+		Length:      len(ex.ResponseBody),
+		Duration:    ex.Duration,
+		ReplayOf:    ex.ReplayOf,
+	}
+}
+
+// 历史记录存储，索引保存在 index.jsonl，每条记录单独保存为 <id>.json
+// 写盘在后台进行，不阻塞代理
+type HistoryStore struct {
+	dir       string
+	summaries []ExchangeSummary
+	byID      map[int64]int
+	unwritten map[int64]*Exchange
+	nextID    int64
+	writeChan chan *Exchange
+	dropped   atomic.Int64 // 写盘队列已满而没有保存的记录数
+	wg        sync.WaitGroup
+	mu        sync.RWMutex
+
+	redact     string        // 敏感头部的脱敏方式
+	maxEntries int           // 最多保留的记录数，0 为不限
+	maxAge     time.Duration // 记录最长保留时间，0 为不限
+	ageChecked time.Time
+}
+
+// SetRedact 设置保存记录时敏感头部的脱敏方式
+func (hs *HistoryStore) SetRedact(mode string) {
+	hs.mu.Lock()
+	hs.redact = mode
+	hs.mu.Unlock()
+}
+
+// SetRetention 设置最多保留的记录数和保留时间，超出的最早的记录在后台删除，0 为不限
+func (hs *HistoryStore) SetRetention(maxEntries int, maxAge time.Duration) {
+	hs.mu.Lock()
+	hs.maxEntries, hs.maxAge = maxEntries, maxAge
+	hs.mu.Unlock()
+}
+
+func NewHistoryStore(dir string) (*HistoryStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	hs := &HistoryStore{
+		dir:       dir,
+		byID:      make(map[int64]int),
+		unwritten: make(map[int64]*Exchange),
+		writeChan: make(chan *Exchange, 10000),
+	}
+	if err := hs.loadIndex(); err != nil {
+		return nil, err
+	}
+	go hs.writeLoop()
+	return hs, nil
+}
+
+// OpenHistoryStore 以只读方式打开历史记录，供命令行工具使用
+func OpenHistoryStore(dir string) (*HistoryStore, error) {
+	hs := &HistoryStore{
+		dir:       dir,
+		byID:      make(map[int64]int),
+		unwritten: make(map[int64]*Exchange),
+	}
+	if err := hs.loadIndex(); err != nil {
+		return nil, err
+	}
+	return hs, nil
+}
+
+func (hs *HistoryStore) loadIndex() error {
+	file, err := os.Open(filepath.Join(hs.dir, "index.jsonl"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var s ExchangeSummary
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			// 跳过异常退出时写了一半的行
+			continue
+		}
+		hs.byID[s.ID] = len(hs.summaries)
+		hs.summaries = append(hs.summaries, s)
+		if s.ID > hs.nextID {
+			hs.nextID = s.ID
+		}
+	}
+	return scanner.Err()
+}
+
+// Add 分配ID并异步保存，写盘队列已满时不保存并返回 0。
+// 保存的是按脱敏方式处理了敏感头部的副本，ex 本身只会被设置 ID
+func (hs *HistoryStore) Add(ex *Exchange) int64 {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	stored := *ex
+	stored.RequestHeader = RedactHeaders(ex.RequestHeader, hs.redact)
+	stored.ResponseHeader = RedactHeaders(ex.ResponseHeader, hs.redact)
+	stored.ID = hs.nextID + 1
+	select {
+	case hs.writeChan <- &stored:
+	default:
+		ex.ID = 0
+		hs.dropped.Add(1)
+		return 0
+	}
+	ex.ID = stored.ID
+	// 持有锁时写盘协程不会在 wg.Add 之前调用 wg.Done
+	hs.nextID = ex.ID
+	hs.byID[ex.ID] = len(hs.summaries)
+	hs.summaries = append(hs.summaries, stored.Summary())
+	hs.unwritten[ex.ID] = &stored
+	hs.wg.Add(1)
+	return ex.ID
+}
+
+// Dropped 返回因写盘队列已满而没有保存的记录数
+func (hs *HistoryStore) Dropped() int64 {
+	return hs.dropped.Load()
+}
+
+func (hs *HistoryStore) writeLoop() {
+	index, err := os.OpenFile(filepath.Join(hs.dir, "index.jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Errorf("打开历史记录索引失败: %v", err)
+	}
+	for ex := range hs.writeChan {
+		if err := hs.write(index, ex); err != nil {
+			logger.Errorf("保存历史记录 #%d 失败: %v", ex.ID, err)
+		}
+		hs.mu.Lock()
+		delete(hs.unwritten, ex.ID)
+		hs.mu.Unlock()
+		hs.prune(&index)
+		hs.wg.Done()
+	}
+	if index != nil {
+		index.Close()
+	}
+}
+
+// 删除超出条数或保存时间上限的最早的记录并重写索引，只在写盘协程中调用
+func (hs *HistoryStore) prune(index **os.File) {
+	hs.mu.Lock()
+	n := 0
+	// 条数超出上限 1% 后再清理，避免每次写入都重写索引
+	if hs.maxEntries > 0 && len(hs.summaries) > hs.maxEntries+hs.maxEntries/100 {
+		n = len(hs.summaries) - hs.maxEntries
+	}
+	if hs.maxAge > 0 && time.Since(hs.ageChecked) > time.Minute {
+		hs.ageChecked = time.Now()
+		cutoff := hs.ageChecked.Add(-hs.maxAge)
+		for n < len(hs.summaries) && hs.summaries[n].Time.Before(cutoff) {
+			n++
+		}
+	}
+	// 记录按顺序写盘，只删除已经写盘的
+	for i := 0; i < n; i++ {
+		if _, ok := hs.unwritten[hs.summaries[i].ID]; ok {
+			n = i
+		}
+	}
+	if n == 0 {
+		hs.mu.Unlock()
+		return
+	}
+	removed := append([]ExchangeSummary(nil), hs.summaries[:n]...)
+	hs.summaries = append([]ExchangeSummary(nil), hs.summaries[n:]...)
+	hs.byID = make(map[int64]int, len(hs.summaries))
+	var written []ExchangeSummary
+	for i, s := range hs.summaries {
+		hs.byID[s.ID] = i
+		if _, ok := hs.unwritten[s.ID]; !ok {
+			written = append(written, s)
+		}
+	}
+	hs.mu.Unlock()
+
+	for _, s := range removed {
+		os.Remove(hs.exchangePath(s.ID))
+		os.Remove(hs.metadataPath(s.ID))
+	}
+	if err := hs.rewriteIndex(index, written); err != nil {
+		logger.Errorf("重写历史记录索引失败: %v", err)
+	}
+	logger.Debugf("已删除 %d 条过期的历史记录", len(removed))
+}
+
+// 用已写盘的记录替换索引文件，并重新打开供追加
+func (hs *HistoryStore) rewriteIndex(index **os.File, written []ExchangeSummary) error {
+	path := filepath.Join(hs.dir, "index.jsonl")
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, s := range written {
+		line, err := json.Marshal(s)
+		if err != nil {
+			continue
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	if *index != nil {
+		(*index).Close()
+	}
+	*index, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	return err
+}
+
+func (hs *HistoryStore) write(index *os.File, ex *Exchange) error {
+	data, err := json.Marshal(ex)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(hs.exchangePath(ex.ID), data, 0644); err != nil {
+		return err
+	}
+	if index == nil {
+		return nil
+	}
+	line, err := json.Marshal(ex.Summary())
+	if err != nil {
+		return err
+	}
+	_, err = index.Write(append(line, '\n'))
+	return err
+}
+
+func (hs *HistoryStore) exchangePath(id int64) string {
+	return filepath.Join(hs.dir, fmt.Sprintf("%d.json", id))
+}
+
+// Flush 等待所有记录写入磁盘
+func (hs *HistoryStore) Flush() {
+	hs.wg.Wait()
+}
+
+func (hs *HistoryStore) Get(id int64) (*Exchange, error) {
+	hs.mu.RLock()
+	pending, ok := hs.unwritten[id]
+	hs.mu.RUnlock()
+	ex := &Exchange{}
+	if ok {
+		*ex = *pending
+	} else {
+		data, err := os.ReadFile(hs.exchangePath(id))
+		if os.IsNotExist(err) {
+			return nil, ErrExchangeNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, ex); err != nil {
+			return nil, err
+		}
+	}
+	if data, err := os.ReadFile(hs.metadataPath(id)); err == nil {
+		json.Unmarshal(data, &ex.Metadata)
+	}
+	return ex, nil
+}
+
+// SetMetadata 保存记录的元数据，元数据在响应处理完后才提取，单独保存为 <id>.meta.json
+func (hs *HistoryStore) SetMetadata(id int64, fields []MetadataField) error {
+	hs.mu.RLock()
+	_, ok := hs.byID[id]
+	hs.mu.RUnlock()
+	if !ok {
+		return ErrExchangeNotFound
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(hs.metadataPath(id), data, 0644)
+}
+
+func (hs *HistoryStore) metadataPath(id int64) string {
+	return filepath.Join(hs.dir, fmt.Sprintf("%d.meta.json", id))
+}
+
+// Summaries 按时间顺序返回所有索引项
+func (hs *HistoryStore) Summaries() []ExchangeSummary {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+	return append([]ExchangeSummary(nil), hs.summaries...)
+}
+
+func (hs *HistoryStore) Count() int {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+	return len(hs.summaries)
+}
@@ -0,0 +1,93 @@
+package fuzhu
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer supersecrettoken123")
+	h.Set("Cookie", "sid=abcdef123456; theme=dark")
+	h.Add("Set-Cookie", "sid=abcdef123456; Path=/; HttpOnly")
+	h.Set("Accept", "text/html")
+
+	if got := RedactHeaders(h, RedactNone); got.Get("Authorization") != "Bearer supersecrettoken123" {
+		t.Errorf("RedactNone changed Authorization: %q", got.Get("Authorization"))
+	}
+
+	for _, mode := range []string{RedactPartial, RedactFull} {
+		got := RedactHeaders(h, mode)
+		for _, key := range []string{"Authorization", "Cookie", "Set-Cookie"} {
+			if strings.Contains(got.Get(key), "abcdef123456") || strings.Contains(got.Get(key), "supersecrettoken123") {
+				t.Errorf("%s: %s leaks secret: %q", mode, key, got.Get(key))
+			}
+		}
+		if !strings.HasPrefix(got.Get("Authorization"), "Bearer ") {
+			t.Errorf("%s: Authorization lost scheme: %q", mode, got.Get("Authorization"))
+		}
+		if !strings.HasPrefix(got.Get("Cookie"), "sid=") || !strings.Contains(got.Get("Cookie"), "; theme=") {
+			t.Errorf("%s: Cookie lost names: %q", mode, got.Get("Cookie"))
+		}
+		if !strings.HasSuffix(got.Get("Set-Cookie"), "; Path=/; HttpOnly") {
+			t.Errorf("%s: Set-Cookie lost attributes: %q", mode, got.Get("Set-Cookie"))
+		}
+		if got.Get("Accept") != "text/html" {
+			t.Errorf("%s: Accept changed: %q", mode, got.Get("Accept"))
+		}
+	}
+	if h.Get("Authorization") != "Bearer supersecrettoken123" {
+		t.Error("RedactHeaders modified its input")
+	}
+}
+
+func TestHistoryRedactAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	hs, err := NewHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs.SetRedact(RedactFull)
+	hs.SetRetention(3, 0)
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer supersecrettoken123")
+	var ids []int64
+	for i := 0; i < 6; i++ {
+		ids = append(ids, hs.Add(&Exchange{Time: time.Now(), Method: "GET", URL: "http://example.com/", RequestHeader: header}))
+		hs.Flush()
+	}
+
+	if hs.Count() != 3 {
+		t.Fatalf("Count = %d, want 3", hs.Count())
+	}
+	for _, id := range ids[:3] {
+		if _, err := hs.Get(id); err == nil {
+			t.Errorf("#%d was not pruned", id)
+		}
+		if _, err := os.Stat(hs.exchangePath(id)); !os.IsNotExist(err) {
+			t.Errorf("#%d file still exists", id)
+		}
+	}
+	ex, err := hs.Get(ids[5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(ex.RequestHeader.Get("Authorization"), "supersecrettoken123") {
+		t.Errorf("Authorization saved in plaintext: %q", ex.RequestHeader.Get("Authorization"))
+	}
+	if header.Get("Authorization") != "Bearer supersecrettoken123" {
+		t.Error("Add modified the caller's headers")
+	}
+
+	reopened, err := OpenHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Count() != 3 {
+		t.Errorf("reopened Count = %d, want 3", reopened.Count())
+	}
+}
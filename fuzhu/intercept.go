@@ -0,0 +1,281 @@
+package fuzhu
+
+import (
+	"errors"
+	"gopr/fuzhu/logger"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 拦截阶段
+const (
+	InterceptPhaseRequest  = "request"
+	InterceptPhaseResponse = "response"
+)
+
+// 拦截处理动作
+const (
+	InterceptActionForward = "forward" // 原样或按编辑内容放行
+	InterceptActionDrop    = "drop"    // 丢弃，直接返回错误响应
+)
+
+var ErrInterceptNotFound = errors.New("intercept item not found")
+
+// 拦截过滤条件，所有非空条件都满足才会拦截
+type InterceptFilter struct {
+	Phase       string         // request / response，为空表示两个阶段都拦截
+	Methods     []string       // 请求方法，为空表示全部
+	URLPattern  *regexp.Regexp // URL 正则，为空表示全部
+	ContentType string         // 响应 Content-Type 前缀，设置后只拦截响应
+	Timeout     time.Duration  // 单条超时，为0时使用管理器默认值
+}
+
+// 被挂起的请求或响应
+type InterceptItem struct {
+	ID         int64       `json:"id"`
+	Phase      string      `json:"phase"`
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code,omitempty"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	Created    time.Time   `json:"created"`
+	Deadline   time.Time   `json:"deadline"`
+
+	decision chan InterceptDecision
+}
+
+// 对挂起项的处理结果，编辑字段为空时保持原值
+type InterceptDecision struct {
+	Action     string      `json:"action"`
+	Method     string      `json:"method,omitempty"`
+	URL        string      `json:"url,omitempty"`
+	StatusCode int         `json:"status_code,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+	TimedOut   bool        `json:"-"`
+}
+
+// 拦截管理器
+type InterceptManager struct {
+	enabled        atomic.Bool
+	defaultTimeout time.Duration
+	filters        []InterceptFilter
+	pending        map[int64]*InterceptItem
+	nextID         int64
+	mu             sync.Mutex
+}
+
+func NewInterceptManager(defaultTimeout time.Duration) *InterceptManager {
+	if defaultTimeout <= 0 {
+		defaultTimeout = 60 * time.Second
+	}
+	return &InterceptManager{
+		defaultTimeout: defaultTimeout,
+		pending:        make(map[int64]*InterceptItem),
+	}
+}
+
+func (im *InterceptManager) Enabled() bool {
+	return im.enabled.Load()
+}
+
+// SetEnabled 开关拦截，关闭时放行所有挂起项
+func (im *InterceptManager) SetEnabled(enabled bool) {
+	im.enabled.Store(enabled)
+	if !enabled {
+		im.ForwardAll()
+	}
+}
+
+func (im *InterceptManager) AddFilter(filter InterceptFilter) {
+	im.mu.Lock()
+	im.filters = append(im.filters, filter)
+	im.mu.Unlock()
+}
+
+func (im *InterceptManager) SetFilters(filters []InterceptFilter) {
+	im.mu.Lock()
+	im.filters = filters
+	im.mu.Unlock()
+}
+
+func (im *InterceptManager) Filters() []InterceptFilter {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return append([]InterceptFilter(nil), im.filters...)
+}
+
+// Match 判断是否需要拦截，返回命中的过滤条件
+func (im *InterceptManager) Match(phase, method, url, contentType string) (InterceptFilter, bool) {
+	if !im.Enabled() {
+		return InterceptFilter{}, false
+	}
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	// 没有配置过滤条件时拦截全部
+	if len(im.filters) == 0 {
+		return InterceptFilter{}, true
+	}
+	for _, f := range im.filters {
+		if f.matches(phase, method, url, contentType) {
+			return f, true
+		}
+	}
+	return InterceptFilter{}, false
+}
+
+func (f InterceptFilter) matches(phase, method, url, contentType string) bool {
+	if f.Phase != "" && f.Phase != phase {
+		return false
+	}
+	if len(f.Methods) > 0 {
+		found := false
+		for _, m := range f.Methods {
+			if strings.EqualFold(m, method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.URLPattern != nil && !f.URLPattern.MatchString(url) {
+		return false
+	}
+	// 请求阶段没有响应类型，设置了 ContentType 的条件不拦截请求
+	if f.ContentType != "" && (phase != InterceptPhaseResponse || !strings.HasPrefix(contentType, f.ContentType)) {
+		return false
+	}
+	return true
+}
+
+// Hold 挂起一项，阻塞直到被处理或超时，超时后原样放行；截止时间可以被 Extend 推迟
+func (im *InterceptManager) Hold(item *InterceptItem, timeout time.Duration) InterceptDecision {
+	if timeout <= 0 {
+		timeout = im.defaultTimeout
+	}
+	item.Created = time.Now()
+	item.Deadline = item.Created.Add(timeout)
+	item.decision = make(chan InterceptDecision, 1)
+
+	im.mu.Lock()
+	im.nextID++
+	item.ID = im.nextID
+	im.pending[item.ID] = item
+	im.mu.Unlock()
+	logger.Infof("[intercept] #%d 已挂起%s %s %s，%s 后自动放行", item.ID, phaseName(item.Phase), item.Method, item.URL, timeout)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case d := <-item.decision:
+			return d
+		case <-timer.C:
+		}
+		im.mu.Lock()
+		_, pending := im.pending[item.ID]
+		remaining := time.Until(item.Deadline)
+		if pending && remaining <= 0 {
+			delete(im.pending, item.ID)
+		}
+		im.mu.Unlock()
+		switch {
+		case !pending:
+			// 超时与处理同时发生，Resolve 已经取走该项，等待它送达的处理结果
+			return <-item.decision
+		case remaining > 0:
+			timer.Reset(remaining)
+			continue
+		}
+		logger.Warnf("[intercept] #%d 等待超时，已原样放行 %s", item.ID, item.URL)
+		return InterceptDecision{Action: InterceptActionForward, TimedOut: true}
+	}
+}
+
+// Extend 把挂起项的截止时间推迟到 timeout 之后，timeout 为0时使用默认值，返回新的截止时间
+func (im *InterceptManager) Extend(id int64, timeout time.Duration) (time.Time, error) {
+	if timeout <= 0 {
+		timeout = im.defaultTimeout
+	}
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	item, ok := im.pending[id]
+	if !ok {
+		return time.Time{}, ErrInterceptNotFound
+	}
+	item.Deadline = time.Now().Add(timeout)
+	return item.Deadline, nil
+}
+
+func phaseName(phase string) string {
+	if phase == InterceptPhaseResponse {
+		return "响应"
+	}
+	return "请求"
+}
+
+// Pending 按挂起顺序返回所有挂起项的副本
+func (im *InterceptManager) Pending() []*InterceptItem {
+	im.mu.Lock()
+	items := make([]*InterceptItem, 0, len(im.pending))
+	for _, item := range im.pending {
+		copied := *item
+		items = append(items, &copied)
+	}
+	im.mu.Unlock()
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items
+}
+
+func (im *InterceptManager) Get(id int64) (*InterceptItem, bool) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	item, ok := im.pending[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *item
+	return &copied, true
+}
+
+// Resolve 处理一个挂起项
+func (im *InterceptManager) Resolve(id int64, decision InterceptDecision) error {
+	if decision.Action != InterceptActionForward && decision.Action != InterceptActionDrop {
+		return errors.New("unknown intercept action: " + decision.Action)
+	}
+	im.mu.Lock()
+	item, ok := im.pending[id]
+	if ok {
+		delete(im.pending, id)
+	}
+	im.mu.Unlock()
+	if !ok {
+		return ErrInterceptNotFound
+	}
+	item.decision <- decision
+	return nil
+}
+
+func (im *InterceptManager) Forward(id int64) error {
+	return im.Resolve(id, InterceptDecision{Action: InterceptActionForward})
+}
+
+func (im *InterceptManager) Drop(id int64) error {
+	return im.Resolve(id, InterceptDecision{Action: InterceptActionDrop})
+}
+
+// ForwardAll 原样放行所有挂起项
+func (im *InterceptManager) ForwardAll() {
+	for _, item := range im.Pending() {
+		_ = im.Forward(item.ID)
+	}
+}
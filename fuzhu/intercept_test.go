@@ -0,0 +1,75 @@
+package fuzhu
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInterceptResolveAtTimeout(t *testing.T) {
+	im := NewInterceptManager(time.Second)
+	for i := 0; i < 200; i++ {
+		item := &InterceptItem{Phase: InterceptPhaseRequest, Method: "GET", URL: "http://example.com/"}
+		result := make(chan InterceptDecision, 1)
+		go func() { result <- im.Hold(item, time.Millisecond) }()
+		// 在超时附近处理，Resolve 成功时 Hold 必须采用该处理结果
+		for im.lastID() != int64(i+1) {
+			time.Sleep(50 * time.Microsecond)
+		}
+		time.Sleep(time.Duration(i%3) * 500 * time.Microsecond)
+		err := im.Drop(int64(i + 1))
+		d := <-result
+		if err == nil && (d.Action != InterceptActionDrop || d.TimedOut) {
+			t.Fatalf("round %d: Resolve succeeded but Hold returned %+v", i, d)
+		}
+		if err != nil && !d.TimedOut {
+			t.Fatalf("round %d: Resolve failed with %v but Hold returned %+v", i, err, d)
+		}
+	}
+}
+
+func TestInterceptExtend(t *testing.T) {
+	im := NewInterceptManager(time.Second)
+	item := &InterceptItem{Phase: InterceptPhaseRequest, Method: "GET", URL: "http://example.com/"}
+	result := make(chan InterceptDecision, 1)
+	go func() { result <- im.Hold(item, 50*time.Millisecond) }()
+	for len(im.Pending()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	id := im.Pending()[0].ID
+	if _, err := im.Extend(id, 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if err := im.Resolve(id, InterceptDecision{Action: InterceptActionForward, Body: []byte("edited")}); err != nil {
+		t.Fatalf("item timed out after Extend: %v", err)
+	}
+	if d := <-result; d.TimedOut || string(d.Body) != "edited" {
+		t.Errorf("decision = %+v", d)
+	}
+	if _, err := im.Extend(id, time.Second); err != ErrInterceptNotFound {
+		t.Errorf("Extend on resolved item = %v", err)
+	}
+}
+
+func TestInterceptFilterContentType(t *testing.T) {
+	f := InterceptFilter{ContentType: "application/json"}
+	tests := []struct {
+		phase, contentType string
+		want               bool
+	}{
+		{InterceptPhaseRequest, "", false},
+		{InterceptPhaseResponse, "application/json; charset=utf-8", true},
+		{InterceptPhaseResponse, "text/html", false},
+	}
+	for _, tt := range tests {
+		if got := f.matches(tt.phase, "GET", "http://example.com/", tt.contentType); got != tt.want {
+			t.Errorf("matches(%s, %q) = %v, want %v", tt.phase, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func (im *InterceptManager) lastID() int64 {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return im.nextID
+}
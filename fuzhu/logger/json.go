@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pterm/pterm"
+)
+
+// JSON 日志中固定的字段，键值对不能覆盖
+var reservedKeys = map[string]bool{"ts": true, "level": true, "caller": true, "msg": true}
+
+// 生成一行 JSON 日志，固定字段在前，键值对按传入顺序在后
+func jsonLine(level pterm.LogLevel, caller, msg string, fields []interface{}) string {
+	var b bytes.Buffer
+	b.WriteString(`{"ts":`)
+	writeJSONValue(&b, time.Now().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSONValue(&b, levelNames[level][1])
+	b.WriteString(`,"caller":`)
+	writeJSONValue(&b, caller)
+	b.WriteString(`,"msg":`)
+	writeJSONValue(&b, msg)
+	for i := 0; i < len(fields); i += 2 {
+		key, value := fieldAt(fields, i)
+		if reservedKeys[key] {
+			key = "field." + key
+		}
+		b.WriteByte(',')
+		writeJSONValue(&b, key)
+		b.WriteByte(':')
+		writeJSONValue(&b, value)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// 错误写为错误信息，无法编码为 JSON 的值写为 fmt 格式
+func writeJSONValue(b *bytes.Buffer, v interface{}) {
+	if err, ok := v.(error); ok {
+		v = err.Error()
+	}
+	data, err := marshalJSON(v)
+	if err != nil {
+		data, _ = marshalJSON(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
+
+// 与 json.Marshal 相同，但不转义 HTML 字符，日志中的地址保持原样
+func marshalJSON(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(b.Bytes(), "\n"), nil
+}
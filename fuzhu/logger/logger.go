@@ -1,20 +1,132 @@
 package logger
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pterm/pterm"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// 日志格式
+const (
+	FormatText = "text"
+	FormatJSON = "json" // 每行一个 JSON 对象，字段为 ts、level、caller、msg 和附加的键值对
+)
+
+// 日志级别，off 为不输出
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+	LevelOff   = "off"
+)
+
+const levelOff = pterm.LogLevel(math.MaxInt32)
+
+var levels = map[string]pterm.LogLevel{
+	LevelDebug: pterm.LogLevelDebug,
+	LevelInfo:  pterm.LogLevelInfo,
+	LevelWarn:  pterm.LogLevelWarn,
+	LevelError: pterm.LogLevelError,
+	LevelOff:   levelOff,
+}
+
+// 日志配置，控制台和文件分别设置级别，应用日志和扫描结果日志使用相同的轮转设置
+type Config struct {
+	Format       string `json:"format"`        // text/json
+	ConsoleLevel string `json:"console_level"` // debug/info/warn/error/off
+	FileLevel    string `json:"file_level"`
+	File         string `json:"file"`          // 应用日志，为空则不写文件
+	FindingsFile string `json:"findings_file"` // 扫描结果事件日志，每条新结果一行 JSON，只追加并轮转，为空则不写
+	MaxSize      int    `json:"max_size"`      // 单个文件的大小上限 (MB)
+	MaxAge       int    `json:"max_age"`       // 旧文件保留天数，0为不按时间清理
+	MaxBackups   int    `json:"max_backups"`   // 旧文件保留个数，0为全部保留
+	Compress     bool   `json:"compress"`      // 压缩旧文件
+	Caller       bool   `json:"caller"`        // 文件日志和 JSON 日志中记录调用位置
+}
+
+// DefaultConfig 返回默认配置：控制台输出调试日志，文件只记录 info 及以上
+func DefaultConfig() Config {
+	return Config{
+		Format:       FormatText,
+		ConsoleLevel: LevelDebug,
+		FileLevel:    LevelInfo,
+		File:         filepath.Join("logs", "app.log"),
+		FindingsFile: filepath.Join("logs", "findings-events.jsonl"),
+		MaxSize:      100,
+		MaxAge:       7,
+		MaxBackups:   7,
+		Caller:       true,
+	}
+}
+
+// LoadConfig 读取 JSON 格式的日志配置，未设置的字段使用默认值
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return config, nil
+}
+
+func (c Config) validate() error {
+	if c.Format != FormatText && c.Format != FormatJSON {
+		return fmt.Errorf("unknown log format %q", c.Format)
+	}
+	for _, level := range []string{c.ConsoleLevel, c.FileLevel} {
+		if _, ok := levels[level]; !ok {
+			return fmt.Errorf("unknown log level %q", level)
+		}
+	}
+	if c.MaxSize < 0 || c.MaxAge < 0 || c.MaxBackups < 0 {
+		return errors.New("log rotation settings must not be negative")
+	}
+	return nil
+}
+
+// 轮转设置相同时沿用已打开的文件
+func (c Config) sameRotation(o Config) bool {
+	return c.MaxSize == o.MaxSize && c.MaxAge == o.MaxAge && c.MaxBackups == o.MaxBackups && c.Compress == o.Compress
+}
+
+func (c Config) rotatingFile(path string, block bool) *asyncWriter {
+	if path == "" {
+		return nil
+	}
+	file := &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    c.MaxSize,
+		MaxBackups: c.MaxBackups,
+		MaxAge:     c.MaxAge,
+		Compress:   c.Compress,
+	}
+	return newAsyncWriter(file, file.Rotate, block)
+}
+
 var (
+	mu            sync.RWMutex
+	config        Config
+	consoleLevel  pterm.LogLevel
+	fileLevel     pterm.LogLevel
+	fileWriter    *asyncWriter
+	findingWriter *asyncWriter
 	defaultLogger *LoggerWrapper
-	fileLogger    *log.Logger
+	consoleWriter io.Writer = os.Stdout
 )
 
 type LoggerWrapper struct {
@@ -22,28 +134,55 @@ type LoggerWrapper struct {
 }
 
 func init() {
-	logDir := filepath.Join("logs")
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		panic(err)
-	}
-	fileWriter := &lumberjack.Logger{
-		Filename:   filepath.Join(logDir, "app.log"),
-		MaxSize:    100,   // 每个日志文件最大尺寸，单位MB
-		MaxBackups: 7,     // 保留7个备份
-		MaxAge:     7,     // 保留7天
-		Compress:   false, // 压缩旧文件
-	}
-
-	fileLogger = log.New(fileWriter, "", 0)
 	defaultLogger = &LoggerWrapper{
 		Logger: pterm.DefaultLogger.
 			WithLevel(pterm.LogLevelTrace).
 			WithTime(true).
 			WithCaller(false),
 	}
+	// 文件在第一次写入时才创建
+	if err := Configure(DefaultConfig()); err != nil {
+		panic(err)
+	}
 }
-func getCaller() string {
-	_, file, line, ok := runtime.Caller(2) // 跳过包装函数
+
+// Configure 应用日志配置，运行中也可以调用，文件路径或轮转设置变化时重新打开文件
+func Configure(c Config) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	rotation := c.sameRotation(config)
+	if fileWriter == nil || c.File != config.File || !rotation {
+		if fileWriter != nil {
+			fileWriter.Close()
+		}
+		fileWriter = c.rotatingFile(c.File, false)
+	}
+	if findingWriter == nil || c.FindingsFile != config.FindingsFile || !rotation {
+		if findingWriter != nil {
+			findingWriter.Close()
+		}
+		// 扫描结果不能丢，队列满时等待写入
+		findingWriter = c.rotatingFile(c.FindingsFile, true)
+	}
+	config = c
+	consoleLevel = levels[c.ConsoleLevel]
+	fileLevel = levels[c.FileLevel]
+	return nil
+}
+
+// CurrentConfig 返回当前的日志配置
+func CurrentConfig() Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return config
+}
+
+// skip 为调用 getCaller 的函数到日志调用方之间的栈帧数
+func getCaller(skip int) string {
+	_, file, line, ok := runtime.Caller(skip + 1)
 	if !ok {
 		return "unknown"
 	}
@@ -53,74 +192,219 @@ func getFormattedTime() string {
 	return time.Now().Format("2006-01-02 15:04:05")
 }
 
-// Sync 确保所有日志都写入磁盘
-func Sync() {
-	if fileLogger != nil {
-		if w, ok := fileLogger.Writer().(*lumberjack.Logger); ok {
-			w.Rotate()
+// SetConsoleWriter 替换控制台输出，文件日志不受影响
+func SetConsoleWriter(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultLogger.Logger = defaultLogger.Logger.WithWriter(w)
+	consoleWriter = w
+}
+
+// Finding 把一条新的扫描结果写入扫描结果事件日志。
+// 每个结果只写一次，之后的误报标记和命中次数不会再写，SIEM、jq 等外部工具应读取这个文件，
+// 而不是 -findings 指定的结果存储文件
+func Finding(v interface{}) {
+	line, err := marshalJSON(v)
+	if err != nil {
+		Warnf("写入扫描结果日志失败: %v", err)
+		return
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if findingWriter != nil {
+		findingWriter.Write(append(line, '\n'))
+	}
+}
+
+// Flush 等待已记录的日志和扫描结果全部写入文件
+func Flush() error {
+	mu.RLock()
+	defer mu.RUnlock()
+	return flushLocked()
+}
+
+func flushLocked() error {
+	var errs []error
+	for _, w := range []*asyncWriter{fileWriter, findingWriter} {
+		if w != nil {
+			errs = append(errs, w.Flush())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Rotate 立即轮转应用日志和扫描结果日志
+func Rotate() error {
+	mu.RLock()
+	defer mu.RUnlock()
+	var errs []error
+	for _, w := range []*asyncWriter{fileWriter, findingWriter} {
+		if w != nil {
+			errs = append(errs, w.Rotate())
 		}
 	}
+	return errors.Join(errs...)
+}
+
+// 日志级别在文本日志和 JSON 日志中的名称
+var levelNames = map[pterm.LogLevel][2]string{
+	pterm.LogLevelDebug: {"DBG", "debug"},
+	pterm.LogLevelInfo:  {"INF", "info"},
+	pterm.LogLevelWarn:  {"WRN", "warn"},
+	pterm.LogLevelError: {"ERR", "error"},
+	pterm.LogLevelFatal: {"FTL", "fatal"},
+}
+
+// 写一条日志，skip 为 output 的调用方到日志调用方之间的栈帧数，fields 为键值对
+// 致命错误无论级别设置都会输出并退出
+func output(level pterm.LogLevel, skip int, msg string, fields []interface{}) {
+	mu.RLock()
+	defer mu.RUnlock()
+	fatal := level == pterm.LogLevelFatal
+	toConsole := fatal || level >= consoleLevel
+	toFile := fileWriter != nil && (fatal || level >= fileLevel)
+	caller := ""
+	if config.Caller && (toFile || toConsole && config.Format == FormatJSON) {
+		caller = getCaller(skip + 1)
+	}
+
+	if config.Format == FormatJSON {
+		line := jsonLine(level, caller, msg, fields) + "\n"
+		if toFile {
+			io.WriteString(fileWriter, line)
+		}
+		if toConsole {
+			io.WriteString(consoleWriter, line)
+		}
+	} else {
+		// 文本格式的键值对跟在消息后面，保持一条日志一行
+		msg += textFields(fields)
+		if toFile {
+			prefix := getFormattedTime()
+			if caller != "" {
+				prefix += " " + caller
+			}
+			fmt.Fprintf(fileWriter, "%s %s: %s\n", prefix, levelNames[level][0], msg)
+		}
+		if toConsole {
+			console := defaultLogger.Logger
+			switch level {
+			case pterm.LogLevelDebug:
+				console.Debug(msg)
+			case pterm.LogLevelInfo:
+				console.Info(msg)
+			case pterm.LogLevelWarn:
+				console.Warn(msg)
+			case pterm.LogLevelError:
+				console.Error(msg)
+			case pterm.LogLevelFatal:
+				// pterm 输出后直接退出
+				flushLocked()
+				console.Fatal(msg)
+			}
+		}
+	}
+	if fatal {
+		flushLocked()
+		os.Exit(1)
+	}
 }
 
 // 导出全局方法
 func Info(v ...interface{}) {
-	msg := fmt.Sprint(v...)
-	fileLogger.Printf("%s %s INF: %s", getFormattedTime(), getCaller(), msg)
-	defaultLogger.Logger.WithCallerOffset(1).Info(msg)
+	output(pterm.LogLevelInfo, 1, fmt.Sprint(v...), nil)
 }
 func Debug(v ...interface{}) {
-	msg := fmt.Sprint(v...)
-	// fileLogger.Printf("%s %s DBG: %s", getFormattedTime(), getCaller(), msg)
-	defaultLogger.Logger.WithCallerOffset(1).Debug(msg)
+	output(pterm.LogLevelDebug, 1, fmt.Sprint(v...), nil)
 }
 func Warn(v ...interface{}) {
-	msg := fmt.Sprint(v...)
-	fileLogger.Printf("%s %s WRN: %s", getFormattedTime(), getCaller(), msg)
-	defaultLogger.Logger.WithCallerOffset(1).Warn(msg)
+	output(pterm.LogLevelWarn, 1, fmt.Sprint(v...), nil)
 }
 func Error(v ...interface{}) {
-	msg := fmt.Sprint(v...)
-	fileLogger.Printf("%s %s ERR: %s", getFormattedTime(), getCaller(), msg)
-	defaultLogger.Logger.WithCallerOffset(1).Error(msg)
+	output(pterm.LogLevelError, 1, fmt.Sprint(v...), nil)
 }
 func Fatal(v ...interface{}) {
-	msg := fmt.Sprint(v...)
-	fileLogger.Printf("%s %s FTL: %s", getFormattedTime(), getCaller(), msg)
-	defaultLogger.Logger.WithCallerOffset(1).Fatal(msg)
+	output(pterm.LogLevelFatal, 1, fmt.Sprint(v...), nil)
 }
 func Print(v ...interface{}) {
-	msg := fmt.Sprint(v...)
-	fileLogger.Printf("%s %s INF: %s", getFormattedTime(), getCaller(), msg)
-	defaultLogger.Logger.WithCallerOffset(1).Info(msg)
+	output(pterm.LogLevelInfo, 1, fmt.Sprint(v...), nil)
 }
 
 func Infof(format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
-	fileLogger.Printf("%s %s INF: %s", getFormattedTime(), getCaller(), msg)
-	defaultLogger.Logger.WithCallerOffset(1).Info(msg)
+	output(pterm.LogLevelInfo, 1, fmt.Sprintf(format, v...), nil)
 }
 func Debugf(format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
-	// fileLogger.Printf("%s %s DBG: %s", getFormattedTime(), getCaller(), msg)
-	defaultLogger.Logger.WithCallerOffset(1).Debug(msg)
+	output(pterm.LogLevelDebug, 1, fmt.Sprintf(format, v...), nil)
 }
 func Warnf(format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
-	fileLogger.Printf("%s %s WRN: %s", getFormattedTime(), getCaller(), msg)
-	defaultLogger.Logger.WithCallerOffset(1).Warn(msg)
+	output(pterm.LogLevelWarn, 1, fmt.Sprintf(format, v...), nil)
 }
 func Errorf(format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
-	fileLogger.Printf("%s %s ERR: %s", getFormattedTime(), getCaller(), msg)
-	defaultLogger.Logger.WithCallerOffset(1).Error(msg)
+	output(pterm.LogLevelError, 1, fmt.Sprintf(format, v...), nil)
 }
 func Fatalf(format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
-	fileLogger.Printf("%s %s FTL: %s", getFormattedTime(), getCaller(), msg)
-	defaultLogger.Logger.WithCallerOffset(1).Fatal(msg)
+	output(pterm.LogLevelFatal, 1, fmt.Sprintf(format, v...), nil)
 }
 func Printf(format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
-	fileLogger.Printf("%s %s INF: %s", getFormattedTime(), getCaller(), msg)
-	defaultLogger.Logger.WithCallerOffset(1).Info(msg)
+	output(pterm.LogLevelInfo, 1, fmt.Sprintf(format, v...), nil)
+}
+
+// 带附加键值对的日志
+type Entry struct {
+	fields []interface{}
+}
+
+// With 返回带附加键值对的日志，参数依次为键和值
+func With(kv ...interface{}) *Entry {
+	return &Entry{fields: kv}
+}
+
+// With 在已有的键值对后追加
+func (e *Entry) With(kv ...interface{}) *Entry {
+	fields := make([]interface{}, 0, len(e.fields)+len(kv))
+	return &Entry{fields: append(append(fields, e.fields...), kv...)}
+}
+
+func (e *Entry) Info(v ...interface{}) {
+	output(pterm.LogLevelInfo, 1, fmt.Sprint(v...), e.fields)
+}
+func (e *Entry) Debug(v ...interface{}) {
+	output(pterm.LogLevelDebug, 1, fmt.Sprint(v...), e.fields)
+}
+func (e *Entry) Warn(v ...interface{}) {
+	output(pterm.LogLevelWarn, 1, fmt.Sprint(v...), e.fields)
+}
+func (e *Entry) Error(v ...interface{}) {
+	output(pterm.LogLevelError, 1, fmt.Sprint(v...), e.fields)
+}
+
+func (e *Entry) Infof(format string, v ...interface{}) {
+	output(pterm.LogLevelInfo, 1, fmt.Sprintf(format, v...), e.fields)
+}
+func (e *Entry) Debugf(format string, v ...interface{}) {
+	output(pterm.LogLevelDebug, 1, fmt.Sprintf(format, v...), e.fields)
+}
+func (e *Entry) Warnf(format string, v ...interface{}) {
+	output(pterm.LogLevelWarn, 1, fmt.Sprintf(format, v...), e.fields)
+}
+func (e *Entry) Errorf(format string, v ...interface{}) {
+	output(pterm.LogLevelError, 1, fmt.Sprintf(format, v...), e.fields)
+}
+
+// 文本日志中键值对追加在消息后，形如 key=value
+func textFields(fields []interface{}) string {
+	var b strings.Builder
+	for i := 0; i < len(fields); i += 2 {
+		key, value := fieldAt(fields, i)
+		fmt.Fprintf(&b, " %s=%v", key, value)
+	}
+	return b.String()
+}
+
+// 键值对个数为奇数时最后一个值没有键
+func fieldAt(fields []interface{}, i int) (string, interface{}) {
+	if i+1 >= len(fields) {
+		return "!BADKEY", fields[i]
+	}
+	return fmt.Sprint(fields[i]), fields[i+1]
 }
@@ -0,0 +1,177 @@
+package logger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+const (
+	// 每个文件等待写入的日志条数上限，超出后应用日志丢弃，日志调用不会因为磁盘慢而阻塞
+	writerQueueSize = 8192
+	writerBufSize   = 64 << 10
+)
+
+var ErrWriterClosed = errors.New("log writer is closed")
+
+// 队列已满而丢弃的应用日志条数
+var droppedTotal atomic.Int64
+
+// Dropped 返回因写入队列已满而丢弃的日志条数
+func Dropped() int64 {
+	return droppedTotal.Load()
+}
+
+// 写入或轮转请求，完成后回复结果
+type writerRequest struct {
+	rotate bool
+	reply  chan error
+}
+
+// 异步写文件，日志调用只把数据放进有界队列，由后台协程批量写入
+type asyncWriter struct {
+	out      io.WriteCloser
+	rotate   func() error
+	buf      *bufio.Writer
+	queue    chan []byte
+	requests chan writerRequest
+	stop     chan struct{}
+	done     chan struct{}
+	failed   bool // 上次写入失败，恢复前不重复报告
+	block    bool // 队列已满时等待而不丢弃，用于不能丢失的扫描结果
+}
+
+func newAsyncWriter(out io.WriteCloser, rotate func() error, block bool) *asyncWriter {
+	w := &asyncWriter{
+		out:      out,
+		rotate:   rotate,
+		block:    block,
+		buf:      bufio.NewWriterSize(out, writerBufSize),
+		queue:    make(chan []byte, writerQueueSize),
+		requests: make(chan writerRequest),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write 复制数据放入队列，队列已满时丢弃并计数，不会阻塞；block 为 true 时等待队列空出
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	if w.block {
+		// 关闭后队列有空位，先检查 done，否则写入可能进入队列后丢失
+		select {
+		case <-w.done:
+			return 0, ErrWriterClosed
+		default:
+		}
+		select {
+		case w.queue <- append([]byte(nil), p...):
+			return len(p), nil
+		case <-w.done:
+			return 0, ErrWriterClosed
+		}
+	}
+	select {
+	case w.queue <- append([]byte(nil), p...):
+	default:
+		droppedTotal.Add(1)
+	}
+	return len(p), nil
+}
+
+func (w *asyncWriter) run() {
+	for {
+		select {
+		case p := <-w.queue:
+			w.write(p)
+			// 队列空了再落盘，繁忙时多条日志合并为一次写入
+			if len(w.queue) == 0 {
+				w.flush()
+			}
+		case req := <-w.requests:
+			w.drain()
+			err := w.flush()
+			if req.rotate && err == nil {
+				err = w.rotate()
+			}
+			req.reply <- err
+		case <-w.stop:
+			w.drain()
+			w.flush()
+			w.out.Close()
+			close(w.done)
+			return
+		}
+	}
+}
+
+func (w *asyncWriter) write(p []byte) {
+	if _, err := w.buf.Write(p); err != nil {
+		w.fail(err)
+	}
+}
+
+func (w *asyncWriter) drain() {
+	for {
+		select {
+		case p := <-w.queue:
+			w.write(p)
+		default:
+			return
+		}
+	}
+}
+
+func (w *asyncWriter) flush() error {
+	err := w.buf.Flush()
+	if err != nil {
+		w.fail(err)
+		return err
+	}
+	w.failed = false
+	return nil
+}
+
+// bufio 出错后会一直返回同一个错误，丢掉缓冲区中的数据后继续
+func (w *asyncWriter) fail(err error) {
+	if !w.failed {
+		fmt.Fprintf(os.Stderr, "写入日志失败: %v\n", err)
+		w.failed = true
+	}
+	w.buf.Reset(w.out)
+}
+
+func (w *asyncWriter) request(rotate bool) error {
+	reply := make(chan error, 1)
+	select {
+	case w.requests <- writerRequest{rotate: rotate, reply: reply}:
+		return <-reply
+	case <-w.done:
+		return ErrWriterClosed
+	}
+}
+
+// Flush 等待队列中的日志全部写入文件
+func (w *asyncWriter) Flush() error {
+	return w.request(false)
+}
+
+// Rotate 写完队列中的日志后轮转文件
+func (w *asyncWriter) Rotate() error {
+	return w.request(true)
+}
+
+// Close 写完队列中的日志后关闭文件
+func (w *asyncWriter) Close() error {
+	select {
+	case <-w.done:
+	default:
+		close(w.stop)
+		<-w.done
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 在 gate 关闭前阻塞写入，模拟很慢的磁盘
+type gatedFile struct {
+	gate chan struct{}
+	mu   sync.Mutex
+	buf  bytes.Buffer
+}
+
+func newGatedFile() *gatedFile {
+	return &gatedFile{gate: make(chan struct{})}
+}
+
+func (f *gatedFile) Write(p []byte) (int, error) {
+	<-f.gate
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.buf.Write(p)
+}
+
+func (f *gatedFile) Close() error {
+	return nil
+}
+
+func (f *gatedFile) lines() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return bytes.Count(f.buf.Bytes(), []byte("\n"))
+}
+
+// 写满缓冲区让后台协程阻塞在文件写入上，之后的写入只能进入队列
+func stallWriter(t *testing.T, w *asyncWriter) {
+	t.Helper()
+	w.Write(bytes.Repeat([]byte("x"), writerBufSize+1))
+	time.Sleep(20 * time.Millisecond)
+}
+
+func TestAsyncWriterBlock(t *testing.T) {
+	f := newGatedFile()
+	w := newAsyncWriter(f, nil, true)
+	stallWriter(t, w)
+	before := Dropped()
+
+	const n = writerQueueSize + 1000
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for i := 0; i < n; i++ {
+			if _, err := w.Write([]byte(fmt.Sprintf("finding %d\n", i))); err != nil {
+				t.Errorf("Write: %v", err)
+				return
+			}
+		}
+	}()
+	select {
+	case <-finished:
+		t.Fatal("writes did not wait for the full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(f.gate)
+	<-finished
+	w.Close()
+	if got := f.lines(); got != n {
+		t.Errorf("wrote %d lines, want %d", got, n)
+	}
+	if Dropped() != before {
+		t.Errorf("block mode dropped %d lines", Dropped()-before)
+	}
+	if _, err := w.Write([]byte("late\n")); err != ErrWriterClosed {
+		t.Errorf("Write after Close = %v, want ErrWriterClosed", err)
+	}
+}
+
+func TestAsyncWriterDrop(t *testing.T) {
+	f := newGatedFile()
+	w := newAsyncWriter(f, nil, false)
+	stallWriter(t, w)
+	before := Dropped()
+
+	const extra = 100
+	for i := 0; i < writerQueueSize+extra; i++ {
+		w.Write([]byte("app log\n"))
+	}
+	if got := Dropped() - before; got != extra {
+		t.Errorf("dropped %d lines, want %d", got, extra)
+	}
+	close(f.gate)
+	w.Close()
+	if got := f.lines(); got != writerQueueSize {
+		t.Errorf("wrote %d lines, want %d", got, writerQueueSize)
+	}
+}
+
+func TestAsyncWriterFlush(t *testing.T) {
+	f := newGatedFile()
+	close(f.gate)
+	w := newAsyncWriter(f, nil, true)
+	defer w.Close()
+	for i := 0; i < 10; i++ {
+		w.Write([]byte("line\n"))
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.lines(); got != 10 {
+		t.Errorf("after Flush %d lines, want 10", got)
+	}
+}
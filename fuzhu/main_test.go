@@ -0,0 +1,19 @@
+package fuzhu
+
+import (
+	"os"
+	"testing"
+
+	"gopr/fuzhu/logger"
+)
+
+// 测试不写日志文件
+func TestMain(m *testing.M) {
+	c := logger.DefaultConfig()
+	c.File, c.FindingsFile = "", ""
+	c.ConsoleLevel = logger.LevelOff
+	if err := logger.Configure(c); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,597 @@
+package fuzhu
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// 元数据来源
+const (
+	MetadataExif     = "exif"
+	MetadataXMP      = "xmp"
+	MetadataPNG      = "png"     // PNG 文本块
+	MetadataComment  = "comment" // JPEG 注释
+	MetadataPDF      = "pdf"     // PDF 文档信息字典
+	MetadataDocProps = "docprops"
+)
+
+const (
+	// 超过这个大小的响应不提取元数据
+	MetadataMaxSize = 32 << 20
+	// 单项元数据和单个文件的读取上限
+	maxMetadataValue = 4096
+	maxMetadataFile  = 1 << 20
+	maxMetadataItems = 500
+)
+
+// 从图片或文档中提取的一项元数据
+type MetadataField struct {
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+}
+
+// HasMetadata 判断是否支持从该类型中提取元数据
+func HasMetadata(class ContentClass) bool {
+	switch class.MIME {
+	case "image/jpeg", "image/png", "image/webp", "application/pdf":
+		return true
+	}
+	// 只看了文件头时 Office Open XML 文档可能只识别为 application/zip
+	return class.Kind == ContentOffice && class.MIME != "application/msword"
+}
+
+// ExtractMetadata 按文件头识别的类型提取 EXIF、XMP、PNG 文本块、PDF 文档信息和 Office 文档属性，
+// 不支持的类型返回 nil；旧版 Office 格式和压缩在对象流中的 PDF 信息不支持
+func ExtractMetadata(data []byte, class ContentClass) []MetadataField {
+	if len(data) > MetadataMaxSize || !HasMetadata(class) {
+		return nil
+	}
+	m := &metadataCollector{seen: make(map[string]bool)}
+	switch class.MIME {
+	case "image/jpeg":
+		m.jpeg(data)
+	case "image/png":
+		m.png(data)
+	case "image/webp":
+		m.webp(data)
+	case "application/pdf":
+		m.pdf(data)
+	default:
+		m.office(data)
+	}
+	return m.fields
+}
+
+// MetadataValues 把元数据转为结构化值，用于按键名和值执行规则，路径形如 /exif/Artist
+func MetadataValues(fields []MetadataField) []StructuredValue {
+	values := make([]StructuredValue, 0, len(fields))
+	for _, f := range fields {
+		values = append(values, StructuredValue{Path: "/" + f.Source + "/" + f.Name, Key: f.Name, Value: f.Value})
+	}
+	return values
+}
+
+type metadataCollector struct {
+	fields []MetadataField
+	seen   map[string]bool
+}
+
+func (m *metadataCollector) add(source, name, value string) {
+	value = strings.TrimSpace(strings.Trim(value, "\x00"))
+	if value == "" || len(m.fields) >= maxMetadataItems {
+		return
+	}
+	if len(value) > maxMetadataValue {
+		value = strings.ToValidUTF8(value[:maxMetadataValue], "")
+	}
+	key := source + "\x00" + name + "\x00" + value
+	if m.seen[key] {
+		return
+	}
+	m.seen[key] = true
+	m.fields = append(m.fields, MetadataField{Source: source, Name: name, Value: value})
+}
+
+func (m *metadataCollector) jpeg(data []byte) {
+	exifHeader := []byte("Exif\x00\x00")
+	xmpHeader := []byte("http://ns.adobe.com/xap/1.0/\x00")
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return
+		}
+		marker := data[i+1]
+		// 没有长度的标记
+		if marker == 0x01 || marker == 0xff || (marker >= 0xd0 && marker <= 0xd7) {
+			i += 2
+			continue
+		}
+		// 图像数据开始后不再有元数据
+		if marker == 0xda || marker == 0xd9 {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return
+		}
+		payload := data[i+4 : i+2+length]
+		switch {
+		case marker == 0xe1 && bytes.HasPrefix(payload, exifHeader):
+			m.exif(payload[len(exifHeader):])
+		case marker == 0xe1 && bytes.HasPrefix(payload, xmpHeader):
+			m.xmp(payload[len(xmpHeader):])
+		case marker == 0xfe:
+			m.add(MetadataComment, "Comment", latin1(payload))
+		}
+		i += 2 + length
+	}
+}
+
+func (m *metadataCollector) png(data []byte) {
+	for i := 8; i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		if length < 0 || i+12+length > len(data) {
+			return
+		}
+		kind := string(data[i+4 : i+8])
+		chunk := data[i+8 : i+8+length]
+		switch kind {
+		case "tEXt":
+			if keyword, text, ok := bytes.Cut(chunk, []byte{0}); ok {
+				m.pngText(string(keyword), []byte(latin1(text)))
+			}
+		case "zTXt":
+			if keyword, rest, ok := bytes.Cut(chunk, []byte{0}); ok && len(rest) > 0 {
+				if text, err := inflate(rest[1:]); err == nil {
+					m.pngText(string(keyword), []byte(latin1(text)))
+				}
+			}
+		case "iTXt":
+			m.pngInternational(chunk)
+		case "eXIf":
+			m.exif(chunk)
+		case "IEND":
+			return
+		}
+		i += 12 + length
+	}
+}
+
+// iTXt: 关键字 \0 压缩标志 压缩方法 语言 \0 翻译后的关键字 \0 文本
+func (m *metadataCollector) pngInternational(chunk []byte) {
+	keyword, rest, ok := bytes.Cut(chunk, []byte{0})
+	if !ok || len(rest) < 2 {
+		return
+	}
+	compressed := rest[0] == 1
+	parts := bytes.SplitN(rest[2:], []byte{0}, 3)
+	if len(parts) != 3 {
+		return
+	}
+	text := parts[2]
+	if compressed {
+		var err error
+		if text, err = inflate(text); err != nil {
+			return
+		}
+	}
+	m.pngText(string(keyword), text)
+}
+
+func (m *metadataCollector) pngText(keyword string, text []byte) {
+	if keyword == "XML:com.adobe.xmp" {
+		m.xmp(text)
+		return
+	}
+	m.add(MetadataPNG, keyword, string(text))
+}
+
+func (m *metadataCollector) webp(data []byte) {
+	for i := 12; i+8 <= len(data); {
+		kind := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if size < 0 || i+8+size > len(data) {
+			return
+		}
+		chunk := data[i+8 : i+8+size]
+		switch kind {
+		case "EXIF":
+			m.exif(bytes.TrimPrefix(chunk, []byte("Exif\x00\x00")))
+		case "XMP ":
+			m.xmp(chunk)
+		}
+		i += 8 + size + size%2
+	}
+}
+
+// EXIF 中记录的标签，其他标签忽略
+var exifTags = map[uint16]string{
+	0x010e: "ImageDescription",
+	0x010f: "Make",
+	0x0110: "Model",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013b: "Artist",
+	0x013c: "HostComputer",
+	0x8298: "Copyright",
+	0x9003: "DateTimeOriginal",
+	0x9286: "UserComment",
+	0x9c9b: "XPTitle",
+	0x9c9c: "XPComment",
+	0x9c9d: "XPAuthor",
+	0x9c9e: "XPKeywords",
+	0x9c9f: "XPSubject",
+	0xa420: "ImageUniqueID",
+	0xa430: "CameraOwnerName",
+	0xa431: "BodySerialNumber",
+	0xa433: "LensMake",
+	0xa434: "LensModel",
+	0xa435: "LensSerialNumber",
+}
+
+const (
+	exifIFDPointer = 0x8769
+	gpsIFDPointer  = 0x8825
+)
+
+// 每种 EXIF 数据类型的单个值字节数
+var exifTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+type exifEntry struct {
+	typ   uint16
+	count int
+	data  []byte
+}
+
+func (m *metadataCollector) exif(tiff []byte) {
+	if len(tiff) < 8 {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return
+	}
+	ifd0 := readIFD(tiff, order, int(order.Uint32(tiff[4:])))
+	m.exifStrings(ifd0)
+	if e, ok := ifd0[exifIFDPointer]; ok && len(e.data) >= 4 {
+		m.exifStrings(readIFD(tiff, order, int(order.Uint32(e.data))))
+	}
+	if e, ok := ifd0[gpsIFDPointer]; ok && len(e.data) >= 4 {
+		m.gps(readIFD(tiff, order, int(order.Uint32(e.data))), order)
+	}
+}
+
+// 读取一个 IFD 中的所有项，偏移越界的项忽略
+func readIFD(tiff []byte, order binary.ByteOrder, offset int) map[uint16]exifEntry {
+	entries := make(map[uint16]exifEntry)
+	if offset < 8 || offset+2 > len(tiff) {
+		return entries
+	}
+	n := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < n; i++ {
+		p := offset + 2 + i*12
+		if p+12 > len(tiff) {
+			break
+		}
+		tag, typ := order.Uint16(tiff[p:]), order.Uint16(tiff[p+2:])
+		count := int(order.Uint32(tiff[p+4:]))
+		size, ok := exifTypeSizes[typ]
+		if !ok || count <= 0 || count > len(tiff) {
+			continue
+		}
+		total := size * count
+		var data []byte
+		if total <= 4 {
+			data = tiff[p+8 : p+8+total]
+		} else {
+			start := int(order.Uint32(tiff[p+8:]))
+			if start < 0 || start+total > len(tiff) {
+				continue
+			}
+			data = tiff[start : start+total]
+		}
+		entries[tag] = exifEntry{typ: typ, count: count, data: data}
+	}
+	return entries
+}
+
+func (m *metadataCollector) exifStrings(entries map[uint16]exifEntry) {
+	tags := make([]uint16, 0, len(entries))
+	for tag := range entries {
+		if _, ok := exifTags[tag]; ok {
+			tags = append(tags, tag)
+		}
+	}
+	slices.Sort(tags)
+	for _, tag := range tags {
+		e, name := entries[tag], exifTags[tag]
+		switch {
+		case strings.HasPrefix(name, "XP"):
+			// Windows 的 XP 标签是 UTF-16LE
+			m.add(MetadataExif, name, utf16LE(e.data))
+		case tag == 0x9286 && len(e.data) > 8:
+			// 前 8 字节为字符集
+			if bytes.HasPrefix(e.data, []byte("UNICODE\x00")) {
+				m.add(MetadataExif, name, utf16LE(e.data[8:]))
+			} else {
+				m.add(MetadataExif, name, latin1(e.data[8:]))
+			}
+		case e.typ == 2 || e.typ == 7:
+			m.add(MetadataExif, name, latin1(e.data))
+		}
+	}
+}
+
+// GPS 坐标转为十进制度数，南纬和西经为负
+func (m *metadataCollector) gps(entries map[uint16]exifEntry, order binary.ByteOrder) {
+	lat, ok1 := gpsCoordinate(entries[2], entries[1], "S", order)
+	lon, ok2 := gpsCoordinate(entries[4], entries[3], "W", order)
+	if ok1 && ok2 {
+		m.add(MetadataExif, "GPSPosition", fmt.Sprintf("%.6f,%.6f", lat, lon))
+	}
+}
+
+func gpsCoordinate(value, ref exifEntry, negative string, order binary.ByteOrder) (float64, bool) {
+	if value.typ != 5 || value.count < 3 || len(value.data) < 24 {
+		return 0, false
+	}
+	var parts [3]float64
+	for i := range parts {
+		num, den := order.Uint32(value.data[i*8:]), order.Uint32(value.data[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+	deg := parts[0] + parts[1]/60 + parts[2]/3600
+	if strings.HasPrefix(latin1(ref.data), negative) {
+		deg = -deg
+	}
+	return deg, !math.IsNaN(deg) && deg >= -180 && deg <= 180
+}
+
+// XMP 中的命名空间声明不是元数据
+var xmpNamespacePrefixes = []string{"http://ns.adobe.com/", "adobe:ns:meta/", "http://www.w3.org/", "http://purl.org/", "http://schemas.openxmlformats.org/", "http://iptc.org/"}
+
+// RDF 的容器元素，值归到外层的属性名下
+var rdfContainers = map[string]bool{"li": true, "Seq": true, "Bag": true, "Alt": true, "Description": true, "RDF": true}
+
+func (m *metadataCollector) xmp(data []byte) {
+	start := bytes.Index(data, []byte("<x:xmpmeta"))
+	end := bytes.Index(data, []byte("</x:xmpmeta>"))
+	if start == -1 || end < start {
+		return
+	}
+	values, ok := WalkXML(data[start : end+len("</x:xmpmeta>")])
+	if !ok {
+		return
+	}
+	for _, v := range values {
+		if isNamespaceValue(v.Value) {
+			continue
+		}
+		name := v.Key
+		if rdfContainers[name] {
+			name = xmlParentName(v.Path)
+		}
+		if name == "" || name == "about" {
+			continue
+		}
+		m.add(MetadataXMP, name, v.Value)
+	}
+}
+
+func isNamespaceValue(value string) bool {
+	for _, prefix := range xmpNamespacePrefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 路径中最近的不是 RDF 容器的元素名
+func xmlParentName(p string) string {
+	segments := strings.Split(p, "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		name := segments[i]
+		if j := strings.IndexByte(name, '['); j != -1 {
+			name = name[:j]
+		}
+		if name != "" && !strings.HasPrefix(name, "@") && !rdfContainers[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+// PDF 文档信息字典中的字段
+var pdfInfoKey = regexp.MustCompile(`/(Author|Creator|Producer|Title|Subject|Keywords|Company|Manager|SourceModified)\s*[(<]`)
+
+func (m *metadataCollector) pdf(data []byte) {
+	for _, loc := range pdfInfoKey.FindAllSubmatchIndex(data, maxMetadataItems) {
+		name := string(data[loc[2]:loc[3]])
+		if value, ok := pdfString(data[loc[1]-1:]); ok {
+			m.add(MetadataPDF, name, value)
+		}
+	}
+	// 未压缩的 XMP 元数据流
+	m.xmp(data)
+}
+
+// 解析 PDF 的字面字符串 (...) 或十六进制字符串 <...>，以 FE FF 开头的按 UTF-16BE 解码
+func pdfString(data []byte) (string, bool) {
+	var raw []byte
+	switch data[0] {
+	case '(':
+		depth := 0
+		for i := 0; i < len(data) && i < maxMetadataValue*2; i++ {
+			c := data[i]
+			switch {
+			case c == '\\' && i+1 < len(data):
+				i++
+				switch e := data[i]; e {
+				case 'n':
+					raw = append(raw, '\n')
+				case 'r':
+					raw = append(raw, '\r')
+				case 't':
+					raw = append(raw, '\t')
+				case 'b', 'f':
+				case '\r', '\n':
+					// 行尾的反斜杠表示续行
+				default:
+					if e >= '0' && e <= '7' {
+						n := 0
+						for j := 0; j < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; j++ {
+							n = n*8 + int(data[i]-'0')
+							i++
+						}
+						i--
+						raw = append(raw, byte(n))
+					} else {
+						raw = append(raw, e)
+					}
+				}
+			case c == '(':
+				if depth > 0 {
+					raw = append(raw, c)
+				}
+				depth++
+			case c == ')':
+				depth--
+				if depth == 0 {
+					return pdfText(raw), true
+				}
+				raw = append(raw, c)
+			default:
+				raw = append(raw, c)
+			}
+		}
+		return "", false
+	case '<':
+		end := bytes.IndexByte(data, '>')
+		if end == -1 {
+			return "", false
+		}
+		digits := bytes.Join(bytes.Fields(data[1:end]), nil)
+		if len(digits)%2 == 1 {
+			digits = append(digits, '0')
+		}
+		raw, err := hex.DecodeString(string(digits))
+		if err != nil {
+			return "", false
+		}
+		return pdfText(raw), true
+	}
+	return "", false
+}
+
+func pdfText(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xfe && raw[1] == 0xff {
+		u := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			u = append(u, binary.BigEndian.Uint16(raw[i:]))
+		}
+		return string(utf16.Decode(u))
+	}
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	return latin1(raw)
+}
+
+// Office Open XML 的文档属性
+var officePropertyFiles = []string{"docProps/core.xml", "docProps/app.xml", "docProps/custom.xml"}
+
+func (m *metadataCollector) office(data []byte) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return
+	}
+	for _, f := range zr.File {
+		if !slices.Contains(officePropertyFiles, f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, maxMetadataFile))
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		values, ok := WalkXML(content)
+		if !ok {
+			continue
+		}
+		// 自定义属性的名称在 property 元素的 name 属性中
+		names := make(map[string]string)
+		for _, v := range values {
+			if v.Key == "name" && strings.HasSuffix(v.Path, "/@name") {
+				names[strings.TrimSuffix(v.Path, "/@name")] = v.Value
+			}
+		}
+		for _, v := range values {
+			if strings.Contains(v.Path, "/@") || isNamespaceValue(v.Value) {
+				continue
+			}
+			name := v.Key
+			if custom, ok := names[path.Dir(v.Path)]; ok {
+				name = custom
+			}
+			m.add(MetadataDocProps, name, v.Value)
+		}
+	}
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, maxMetadataFile))
+}
+
+// EXIF 和 PNG 文本按 Latin-1 解码，已经是 UTF-8 的保持不变
+func latin1(b []byte) string {
+	b = bytes.TrimRight(b, "\x00 ")
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+func utf16LE(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, binary.LittleEndian.Uint16(b[i:]))
+	}
+	return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+}
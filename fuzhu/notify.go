@@ -0,0 +1,437 @@
+package fuzhu
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"gopr/fuzhu/logger"
+)
+
+// 通知消息格式
+const (
+	NotifyJSON     = "json" // 通用 JSON，包含完整的扫描结果
+	NotifyDingTalk = "dingtalk"
+	NotifyWeCom    = "wecom"
+	NotifyFeishu   = "feishu"
+	NotifySlack    = "slack" // Slack 及兼容 incoming webhook 的服务，例如 Mattermost、Rocket.Chat
+)
+
+var NotifyFormats = []string{NotifyJSON, NotifyDingTalk, NotifyWeCom, NotifyFeishu, NotifySlack}
+
+const (
+	DefaultNotifySeverity      = SeverityHigh
+	DefaultNotifyRatePerMinute = 20 // 钉钉机器人每分钟最多 20 条
+	DefaultNotifyRetries       = 3
+	notifyQueueSize            = 256
+	notifyTimeout              = 10 * time.Second
+)
+
+// 默认的消息模板，数据为 Finding，可用 upper、truncate、redact 函数，例如 {{.Value | redact "partial"}}
+const DefaultNotifyTemplate = `[{{upper .Severity}}] {{.Rule}}
+{{.Method}} {{.URL}}
+{{truncate 200 .Value}}{{with .Context}}
+位置: {{.Location}}{{end}}{{with .Token}}
+令牌: {{.}}{{end}}`
+
+// 一个通知目标
+type Webhook struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Format      string `json:"format"`       // 为空时为 json
+	MinSeverity string `json:"min_severity"` // 为空时使用全局阈值
+	Template    string `json:"template"`     // 为空时使用默认模板
+	Secret      string `json:"secret"`       // 钉钉、飞书机器人的加签密钥
+}
+
+// 通知配置，从 JSON 文件读取
+type NotifyConfig struct {
+	Webhooks      []Webhook `json:"webhooks"`
+	MinSeverity   string    `json:"min_severity"`    // 不低于这个严重程度才通知，默认 high
+	RatePerMinute int       `json:"rate_per_minute"` // 每个目标每分钟最多发送的消息数
+	Retries       int       `json:"retries"`         // 发送失败后的重试次数，默认 3，负数为不重试
+	Redact        string    `json:"redact"`          // 消息中密钥的脱敏方式，为空时不脱敏
+}
+
+// LoadNotifyConfig 读取通知配置文件
+func LoadNotifyConfig(path string) (*NotifyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config NotifyConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// 通知统计
+type NotifyStats struct {
+	Sent    int64 `json:"sent"`
+	Failed  int64 `json:"failed"`  // 重试后仍失败
+	Dropped int64 `json:"dropped"` // 队列已满丢弃
+	Retried int64 `json:"retried"`
+}
+
+// 发送通知的目标，每个目标有独立的队列和限速
+type notifyTarget struct {
+	hook        Webhook
+	minSeverity int
+	tmpl        *template.Template
+	queue       chan *Finding
+}
+
+// 通知器，把新的扫描结果异步推送到各个 webhook
+type Notifier struct {
+	config  NotifyConfig
+	client  *http.Client
+	targets []*notifyTarget
+	wg      sync.WaitGroup
+	// 保护 closed 和队列的关闭，Notify 持读锁发送，Close 持写锁关闭队列
+	mu     sync.RWMutex
+	closed bool
+
+	sent, failed, dropped, retried atomic.Int64
+}
+
+var notifyFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"truncate": func(n int, s string) string {
+		if r := []rune(s); len(r) > n {
+			return string(r[:n]) + "..."
+		}
+		return s
+	},
+	"redact": func(mode, s string) string {
+		return RedactSecret(s, mode)
+	},
+}
+
+// NewNotifier 检查配置并为每个目标启动发送协程
+func NewNotifier(config NotifyConfig) (*Notifier, error) {
+	if config.MinSeverity == "" {
+		config.MinSeverity = DefaultNotifySeverity
+	}
+	if config.RatePerMinute <= 0 {
+		config.RatePerMinute = DefaultNotifyRatePerMinute
+	}
+	if config.Retries == 0 {
+		config.Retries = DefaultNotifyRetries
+	} else if config.Retries < 0 {
+		config.Retries = 0
+	}
+	n := &Notifier{config: config, client: &http.Client{Timeout: notifyTimeout}}
+	for i, hook := range config.Webhooks {
+		if hook.Name == "" {
+			hook.Name = fmt.Sprintf("webhook-%d", i+1)
+		}
+		if hook.Format == "" {
+			hook.Format = NotifyJSON
+		}
+		if !slices.Contains(NotifyFormats, hook.Format) {
+			return nil, fmt.Errorf("%s: unknown format %q", hook.Name, hook.Format)
+		}
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("%s: invalid url %q", hook.Name, hook.URL)
+		}
+		text := hook.Template
+		if text == "" {
+			text = DefaultNotifyTemplate
+		}
+		tmpl, err := template.New(hook.Name).Funcs(notifyFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hook.Name, err)
+		}
+		severity := hook.MinSeverity
+		if severity == "" {
+			severity = config.MinSeverity
+		}
+		n.targets = append(n.targets, &notifyTarget{
+			hook:        hook,
+			minSeverity: SeverityRank(severity),
+			tmpl:        tmpl,
+			queue:       make(chan *Finding, notifyQueueSize),
+		})
+	}
+	for _, t := range n.targets {
+		n.wg.Add(1)
+		go n.run(t)
+	}
+	return n, nil
+}
+
+// Notify 把扫描结果放入达到阈值的目标的队列，不阻塞，队列满时丢弃
+func (n *Notifier) Notify(f *Finding) {
+	c := n.prepare(f)
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return
+	}
+	for _, t := range n.targets {
+		if SeverityRank(c.Severity) < t.minSeverity {
+			continue
+		}
+		select {
+		case t.queue <- c:
+		default:
+			n.dropped.Add(1)
+			logger.Warnf("[notify] %s 队列已满，丢弃扫描结果 #%d", t.hook.Name, f.ID)
+		}
+	}
+}
+
+// Send 立即向所有目标发送，不检查阈值和限速，用于测试配置
+func (n *Notifier) Send(f *Finding) error {
+	c := n.prepare(f)
+	var errs []error
+	for _, t := range n.targets {
+		if err := n.deliver(t, c); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.hook.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close 停止接收新的通知，等待队列中的消息发送完毕或超时
+func (n *Notifier) Close(timeout time.Duration) {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return
+	}
+	n.closed = true
+	for _, t := range n.targets {
+		close(t.queue)
+	}
+	n.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		logger.Warnf("[notify] 等待通知发送超时")
+	}
+}
+
+func (n *Notifier) Stats() NotifyStats {
+	return NotifyStats{
+		Sent:    n.sent.Load(),
+		Failed:  n.failed.Load(),
+		Dropped: n.dropped.Load(),
+		Retried: n.retried.Load(),
+	}
+}
+
+// 复制扫描结果，按配置对值、上下文和令牌脱敏；前后内容中可能还有其他密钥，脱敏时不发送
+func (n *Notifier) prepare(f *Finding) *Finding {
+	c := *f
+	if n.config.Redact != "" && n.config.Redact != RedactNone {
+		c.Value = RedactSecret(c.Value, n.config.Redact)
+		if f.Context != nil {
+			ctx := *f.Context
+			ctx.Value = RedactSecret(ctx.Value, n.config.Redact)
+			ctx.Before, ctx.After = "", ""
+			c.Context = &ctx
+		}
+		c.Token = f.Token.Redacted(n.config.Redact)
+	}
+	return &c
+}
+
+// 逐条发送队列中的消息，相邻两条之间至少间隔 1 分钟/速率
+func (n *Notifier) run(t *notifyTarget) {
+	defer n.wg.Done()
+	interval := time.Minute / time.Duration(n.config.RatePerMinute)
+	var last time.Time
+	for f := range t.queue {
+		if wait := time.Until(last.Add(interval)); wait > 0 {
+			time.Sleep(wait)
+		}
+		last = time.Now()
+		if err := n.deliver(t, f); err != nil {
+			logger.Errorf("[notify] %s 发送扫描结果 #%d 失败: %v", t.hook.Name, f.ID, err)
+		}
+	}
+}
+
+// 发送一条消息，可重试的错误按 1s、2s、4s... 退避重试
+func (n *Notifier) deliver(t *notifyTarget, f *Finding) error {
+	var err error
+	for attempt := 0; attempt <= n.config.Retries; attempt++ {
+		if attempt > 0 {
+			n.retried.Add(1)
+			time.Sleep(time.Second << (attempt - 1))
+		}
+		if err = n.post(t, f); err == nil {
+			n.sent.Add(1)
+			return nil
+		}
+		var ne *notifyError
+		if errors.As(err, &ne) && !ne.retry {
+			break
+		}
+	}
+	n.failed.Add(1)
+	return err
+}
+
+// 发送失败的原因，retry 表示可以重试
+type notifyError struct {
+	msg   string
+	retry bool
+}
+
+func (e *notifyError) Error() string {
+	return e.msg
+}
+
+// 机器人接口的限流错误码：钉钉 130101、企业微信 45009、飞书 11232
+var notifyRateLimitCodes = []int{130101, 45009, 11232}
+
+func (n *Notifier) post(t *notifyTarget, f *Finding) error {
+	var text bytes.Buffer
+	if err := t.tmpl.Execute(&text, f); err != nil {
+		return &notifyError{msg: "template: " + err.Error()}
+	}
+	target, body, err := t.payload(f, text.String(), time.Now())
+	if err != nil {
+		return &notifyError{msg: err.Error()}
+	}
+	resp, err := n.client.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return &notifyError{msg: err.Error(), retry: true}
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return &notifyError{msg: resp.Status, retry: true}
+	}
+	if resp.StatusCode/100 != 2 {
+		return &notifyError{msg: fmt.Sprintf("%s: %s", resp.Status, bytes.TrimSpace(respBody))}
+	}
+	// 钉钉、企业微信返回 errcode，飞书返回 code，成功时为 0
+	var result struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if json.Unmarshal(respBody, &result) != nil {
+		return nil
+	}
+	code, msg := 0, result.ErrMsg
+	if result.ErrCode != nil {
+		code = *result.ErrCode
+	} else if result.Code != nil {
+		code, msg = *result.Code, result.Msg
+	}
+	if code != 0 {
+		return &notifyError{msg: fmt.Sprintf("code %d: %s", code, msg), retry: slices.Contains(notifyRateLimitCodes, code)}
+	}
+	return nil
+}
+
+// 按目标格式生成请求地址和请求体，钉钉的签名在地址中，飞书的签名在请求体中
+func (t *notifyTarget) payload(f *Finding, text string, now time.Time) (string, []byte, error) {
+	target := t.hook.URL
+	var v interface{}
+	switch t.hook.Format {
+	case NotifyDingTalk:
+		if t.hook.Secret != "" {
+			ts := strconv.FormatInt(now.UnixMilli(), 10)
+			mac := hmac.New(sha256.New, []byte(t.hook.Secret))
+			mac.Write([]byte(ts + "\n" + t.hook.Secret))
+			sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+			sep := "?"
+			if strings.Contains(target, "?") {
+				sep = "&"
+			}
+			target += sep + "timestamp=" + ts + "&sign=" + url.QueryEscape(sign)
+		}
+		v = map[string]interface{}{"msgtype": "text", "text": map[string]string{"content": text}}
+	case NotifyWeCom:
+		v = map[string]interface{}{"msgtype": "text", "text": map[string]string{"content": text}}
+	case NotifyFeishu:
+		m := map[string]interface{}{"msg_type": "text", "content": map[string]string{"text": text}}
+		if t.hook.Secret != "" {
+			ts := strconv.FormatInt(now.Unix(), 10)
+			mac := hmac.New(sha256.New, []byte(ts+"\n"+t.hook.Secret))
+			m["timestamp"] = ts
+			m["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		}
+		v = m
+	case NotifySlack:
+		v = map[string]string{"text": text}
+	default:
+		v = map[string]interface{}{"event": "finding", "text": text, "finding": f}
+	}
+	body, err := json.Marshal(v)
+	return target, body, err
+}
+
+// 模拟的 webhook 接收端，记录收到的消息并按机器人接口的格式返回成功
+type MockReceiver struct {
+	FailFirst int // 前几次请求返回 500，用于测试重试
+	OnReceive func(MockMessage)
+
+	mu       sync.Mutex
+	requests int
+	messages []MockMessage
+}
+
+// 接收端收到的一条消息
+type MockMessage struct {
+	Time time.Time       `json:"time"`
+	Path string          `json:"path"`
+	Body json.RawMessage `json:"body"`
+}
+
+func (mr *MockReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil || !json.Valid(body) {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	mr.mu.Lock()
+	mr.requests++
+	if mr.requests <= mr.FailFirst {
+		mr.mu.Unlock()
+		http.Error(w, "mock failure", http.StatusInternalServerError)
+		return
+	}
+	msg := MockMessage{Time: time.Now(), Path: r.URL.RequestURI(), Body: body}
+	mr.messages = append(mr.messages, msg)
+	mr.mu.Unlock()
+	if mr.OnReceive != nil {
+		mr.OnReceive(msg)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"errcode":0,"errmsg":"ok","code":0,"msg":"success","ok":true}`))
+}
+
+// Messages 返回收到的所有消息
+func (mr *MockReceiver) Messages() []MockMessage {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	return append([]MockMessage(nil), mr.messages...)
+}
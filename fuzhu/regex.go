@@ -1,23 +1,58 @@
 package fuzhu
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"sync"
+	"time"
 )
 
+var ErrRuleNotFound = errors.New("rule not found")
+
 // 正则表达式管理器
 type RegexManager struct {
-	regexps []*regexp.Regexp
-	mu      sync.RWMutex
+	regexps    []*regexp.Regexp
+	keyRegexps []*regexp.Regexp // 键名规则，普通规则为 nil
+	rules      []Rule
+	stats      []*ruleStats
+	mu         sync.RWMutex
+}
+
+// 扫描规则，ID 为添加顺序
+type Rule struct {
+	ID         int         `json:"id"`
+	Name       string      `json:"name"`
+	Pattern    string      `json:"pattern"`
+	Severity   string      `json:"severity"`
+	Enabled    bool        `json:"enabled"`
+	Validators []Validator `json:"-"` // 匹配后的校验，全部通过才算命中
+	// 键名规则只用于 JSON/XML 结构化扫描，键名和值同时匹配才算命中，Pattern 为空表示任意值
+	KeyPattern string `json:"key_pattern,omitempty"`
+	// 只扫描不超过这个大小的内容，0 表示使用默认值
+	MaxBodySize int `json:"max_body_size,omitempty"`
+	// 单次执行的耗时预算，多次超出后规则被降级，0 表示使用默认值
+	Budget  time.Duration `json:"budget,omitempty"`
+	Demoted bool          `json:"demoted,omitempty"`
+	// 应当命中和不应命中的样例，由 gopr rules test 检查，键名规则的样例为 JSON 或 XML 文档
+	Examples         []string `json:"examples,omitempty"`
+	NegativeExamples []string `json:"negative_examples,omitempty"`
 }
 type Match struct {
+	Rule        string            // 规则名称
+	Severity    string            // 规则的严重程度
 	Pattern     string            // 匹配的正则表达式
 	Value       string            // 完整匹配内容
 	Groups      map[string]string // 命名分组结果
 	GroupValues []string          // 所有分组结果（包括未命名的）
 	Index       int               // 匹配位置
 	Length      int               // 匹配长度
+	Secret      string            // 用于校验的值：secret 分组、最后一个分组或完整匹配
+	Validations []ValidationResult
+	Decoding    string // 解码路径，为空表示在原始数据中匹配
+	Source      []byte // 匹配所在的数据，Index 相对于它
+	Path        string // 结构化扫描时值所在的 JSON pointer 或 XPath
+	Key         string // 结构化扫描时值对应的键名
 }
 
 func NewRegexManager() *RegexManager {
@@ -27,89 +62,187 @@ func NewRegexManager() *RegexManager {
 }
 
 func (rm *RegexManager) AddPattern(pattern string) error {
+	return rm.AddRule(Rule{Name: pattern, Pattern: pattern})
+}
+
+// AddRule 添加规则，名称为空时使用正则本身，新规则默认启用
+func (rm *RegexManager) AddRule(rule Rule) error {
+	pattern := rule.Pattern
+	var keyRe *regexp.Regexp
+	if rule.KeyPattern != "" {
+		var err error
+		if keyRe, err = regexp.Compile(rule.KeyPattern); err != nil {
+			return err
+		}
+		if pattern == "" {
+			pattern = `(?s).+`
+		}
+	}
 	re, err := regexp.Compile(pattern)
 	if err != nil {
 		return err
 	}
+	if rule.Name == "" {
+		rule.Name = rule.Pattern
+		if rule.Name == "" {
+			rule.Name = rule.KeyPattern
+		}
+	}
+	if rule.Severity == "" {
+		rule.Severity = SeverityMedium
+	}
+	rule.Enabled = true
 	rm.mu.Lock()
+	rule.ID = len(rm.rules)
 	rm.regexps = append(rm.regexps, re)
+	rm.keyRegexps = append(rm.keyRegexps, keyRe)
+	rm.rules = append(rm.rules, rule)
+	rm.stats = append(rm.stats, &ruleStats{})
 	rm.mu.Unlock()
 	return nil
 }
 
-func (rm *RegexManager) MatchAll(data []byte) []Match {
-	var matches []Match
+func (rm *RegexManager) Rules() []Rule {
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
+	rules := append([]Rule(nil), rm.rules...)
+	for i := range rules {
+		rules[i].Demoted = rm.stats[i].demoted.Load()
+	}
+	return rules
+}
+
+func (rm *RegexManager) SetRuleEnabled(id int, enabled bool) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if id < 0 || id >= len(rm.rules) {
+		return ErrRuleNotFound
+	}
+	rm.rules[id].Enabled = enabled
+	if enabled {
+		// 重新启用时取消降级
+		rm.stats[id].demoted.Store(false)
+		rm.stats[id].overBudget.Store(0)
+	}
+	return nil
+}
+
+// MatchAll 用普通规则匹配数据，规则在锁内复制，在锁外并发执行
+func (rm *RegexManager) MatchAll(data []byte) []Match {
+	return runRules(rm.snapshot(), func(sr ruleSnapshot) []Match {
+		if sr.keyRe != nil || !sr.stats.allow(&sr.rule, len(data)) {
+			return nil
+		}
+		var allIndexes [][]int
+		sr.timed(len(data), func() {
+			allIndexes = sr.re.FindAllSubmatchIndex(data, -1)
+		})
 
-	matchChan := make(chan []Match, len(rm.regexps))
-	var wg sync.WaitGroup
-
-	for _, re := range rm.regexps {
-		wg.Add(1)
-		go func(re *regexp.Regexp) {
-			defer wg.Done()
-			var results []Match
-
-			groupNames := re.SubexpNames()
-			allMatches := re.FindAllSubmatch(data, -1)
-			allIndexes := re.FindAllSubmatchIndex(data, -1)
-
-			// 使用map去重
-			seen := make(map[string]bool)
-
-			for i, submatch := range allMatches {
-				// 跳过空匹配
-				if len(submatch) == 0 || len(submatch[0]) == 0 {
-					continue
-				}
-
-				// 检查是否重复
-				matchKey := string(submatch[0])
-				if seen[matchKey] {
-					continue
-				}
-				seen[matchKey] = true
-
-				match := Match{
-					Pattern:     re.String(),
-					Value:       matchKey,
-					Groups:      make(map[string]string),
-					GroupValues: make([]string, 0, len(submatch)),
-					Index:       allIndexes[i][0],
-					Length:      allIndexes[i][1] - allIndexes[i][0],
-				}
-
-				// 处理分组，跳过空分组
-				for j, group := range submatch {
-					if len(group) > 0 {
-						match.GroupValues = append(match.GroupValues, string(group))
-						if j > 0 && j < len(groupNames) && groupNames[j] != "" {
-							match.Groups[groupNames[j]] = string(group)
-						}
-					}
-				}
-
-				results = append(results, match)
+		groupNames := sr.re.SubexpNames()
+		var results []Match
+		// 使用map去重
+		seen := make(map[string]bool)
+		for _, loc := range allIndexes {
+			submatch := submatches(data, loc)
+			// 跳过空匹配
+			if len(submatch) == 0 || len(submatch[0]) == 0 {
+				continue
 			}
 
-			if len(results) > 0 {
-				matchChan <- results
+			// 检查是否重复
+			matchKey := string(submatch[0])
+			if seen[matchKey] {
+				continue
 			}
-		}(re)
+			seen[matchKey] = true
+
+			match, ok := newMatch(sr.re, sr.rule, groupNames, submatch, loc)
+			if !ok {
+				continue
+			}
+			results = append(results, match)
+		}
+		return results
+	})
+}
+
+// 按 FindSubmatchIndex 的结果取出各分组，未参与匹配的分组为 nil
+func submatches(data []byte, loc []int) [][]byte {
+	submatch := make([][]byte, len(loc)/2)
+	for j := range submatch {
+		if loc[2*j] >= 0 {
+			submatch[j] = data[loc[2*j]:loc[2*j+1]]
+		}
+	}
+	return submatch
+}
+
+// 由一次正则匹配生成匹配结果，校验不通过时返回 false
+func newMatch(re *regexp.Regexp, rule Rule, groupNames []string, submatch [][]byte, index []int) (Match, bool) {
+	match := Match{
+		Rule:        rule.Name,
+		Severity:    rule.Severity,
+		Pattern:     re.String(),
+		Value:       string(submatch[0]),
+		Groups:      make(map[string]string),
+		GroupValues: make([]string, 0, len(submatch)),
+		Index:       index[0],
+		Length:      index[1] - index[0],
+	}
+
+	// 处理分组，跳过空分组
+	for j, group := range submatch {
+		if len(group) > 0 {
+			match.GroupValues = append(match.GroupValues, string(group))
+			if j > 0 && j < len(groupNames) && groupNames[j] != "" {
+				match.Groups[groupNames[j]] = string(group)
+			}
+		}
 	}
 
-	go func() {
-		wg.Wait()
-		close(matchChan)
-	}()
+	match.Secret = secretValue(match)
+	validations, passed := RunValidators(rule.Validators, match.Secret)
+	if !passed {
+		return match, false
+	}
+	match.Validations = validations
+	return match, true
+}
 
-	for results := range matchChan {
-		matches = append(matches, results...)
+// 取出匹配中需要校验的值
+func secretValue(m Match) string {
+	if v, ok := m.Groups["secret"]; ok {
+		return v
+	}
+	if len(m.GroupValues) > 1 {
+		return m.GroupValues[len(m.GroupValues)-1]
 	}
+	return m.Value
+}
 
+// MatchDecoded 先匹配原始数据，再逐层解码后重新匹配，相同规则和值只保留最先找到的
+func (rm *RegexManager) MatchDecoded(data []byte, depth int) []Match {
+	matches := rm.MatchAll(data)
+	seen := make(map[string]bool, len(matches))
+	for i := range matches {
+		matches[i].Source = data
+		seen[matches[i].Rule+"\x00"+matches[i].Value] = true
+	}
+	for _, layer := range DecodeLayers(data, depth) {
+		for _, m := range rm.MatchAll(layer.Data) {
+			key := m.Rule + "\x00" + m.Value
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			m.Decoding = layer.Path
+			m.Source = layer.Data
+			matches = append(matches, m)
+		}
+	}
 	return matches
 }
+
 func (rm *RegexManager) MatchAllString(data string) []Match {
 	return rm.MatchAll([]byte(data))
 }
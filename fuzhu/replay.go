@@ -0,0 +1,216 @@
+package fuzhu
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aryann/difflib"
+)
+
+// 重放时对原始请求的修改，字段为空时保持原值
+type ReplayOptions struct {
+	Method string      `json:"method,omitempty"`
+	URL    string      `json:"url,omitempty"`    // 替换完整URL
+	Target string      `json:"target,omitempty"` // 只替换 scheme://host[:port]
+	Header http.Header `json:"header,omitempty"` // 覆盖同名请求头
+	Body   *[]byte     `json:"body,omitempty"`   // 非nil时替换请求体
+}
+
+// 记录中的请求体只保存了开头，需要用 Body 提供完整的请求体才能重放
+var ErrRequestBodyTruncated = errors.New("request body was truncated in history, provide a replacement body")
+
+// 行级 diff 的最大行数，超过时只比较摘要，避免 LCS 矩阵过大
+const replayDiffMaxLines = 2000
+
+// 重放结果与原始记录的差异
+type ExchangeDiff struct {
+	OriginalID     int64    `json:"original_id"`
+	OriginalStatus int      `json:"original_status"`
+	ReplayStatus   int      `json:"replay_status"`
+	OriginalLength int      `json:"original_length"`
+	ReplayLength   int      `json:"replay_length"`
+	HeaderChanges  []string `json:"header_changes,omitempty"`
+	BodyChanges    []string `json:"body_changes,omitempty"`
+	BodyIdentical  bool     `json:"body_identical"`
+	NewMatches     []string `json:"new_matches,omitempty"`  // 仅在重放响应中出现的匹配
+	GoneMatches    []string `json:"gone_matches,omitempty"` // 仅在原始响应中出现的匹配
+}
+
+func BuildReplayRequest(ex *Exchange, opts ReplayOptions) (*http.Request, error) {
+	method := ex.Method
+	if opts.Method != "" {
+		method = opts.Method
+	}
+	rawURL := ex.URL
+	if opts.URL != "" {
+		rawURL = opts.URL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Target != "" {
+		target, err := url.Parse(opts.Target)
+		if err != nil {
+			return nil, err
+		}
+		u.Scheme = target.Scheme
+		u.Host = target.Host
+	}
+	body := ex.RequestBody
+	if opts.Body != nil {
+		body = *opts.Body
+	} else if ex.RequestBodyTruncated {
+		return nil, ErrRequestBodyTruncated
+	}
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = ex.RequestHeader.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	for k, v := range opts.Header {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	req.Header.Del("Content-Length")
+	// 交给 transport 处理压缩，保证拿到的是解压后的响应
+	req.Header.Del("Accept-Encoding")
+	req.ContentLength = int64(len(body))
+	return req, nil
+}
+
+// Replay 通过给定的 transport 重新发送记录中的请求
+func Replay(rt http.RoundTripper, ex *Exchange, opts ReplayOptions) (*Exchange, error) {
+	req, err := BuildReplayRequest(ex, opts)
+	if err != nil {
+		return nil, err
+	}
+	var reqBody []byte
+	if req.ContentLength > 0 {
+		reqBody, _ = io.ReadAll(req.Body)
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	start := time.Now()
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Exchange{
+		Time:           start,
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		Host:           req.URL.Host,
+		RequestHeader:  req.Header,
+		RequestBody:    reqBody,
+		StatusCode:     resp.StatusCode,
+		ResponseHeader: resp.Header,
+		ResponseBody:   respBody,
+		Duration:       time.Since(start),
+		ReplayOf:       ex.ID,
+	}, nil
+}
+
+// DiffExchanges 比较原始响应与重放响应，rm 不为 nil 时同时比较正则匹配结果
+func DiffExchanges(orig, replay *Exchange, rm *RegexManager) ExchangeDiff {
+	diff := ExchangeDiff{
+		OriginalID:     orig.ID,
+		OriginalStatus: orig.StatusCode,
+		ReplayStatus:   replay.StatusCode,
+		OriginalLength: len(orig.ResponseBody),
+		ReplayLength:   len(replay.ResponseBody),
+		BodyIdentical:  bytes.Equal(orig.ResponseBody, replay.ResponseBody),
+		HeaderChanges:  diffHeaders(orig.ResponseHeader, replay.ResponseHeader),
+	}
+
+	if !diff.BodyIdentical {
+		oldLines := strings.Split(string(orig.ResponseBody), "\n")
+		newLines := strings.Split(string(replay.ResponseBody), "\n")
+		if len(oldLines) > replayDiffMaxLines || len(newLines) > replayDiffMaxLines {
+			diff.BodyChanges = []string{"~ body too large for line diff"}
+		} else {
+			for _, rec := range difflib.Diff(oldLines, newLines) {
+				if rec.Delta != difflib.Common {
+					diff.BodyChanges = append(diff.BodyChanges, rec.String())
+				}
+			}
+		}
+	}
+
+	if rm != nil {
+		oldValues := matchValues(rm.MatchAll(orig.ResponseBody))
+		newValues := matchValues(rm.MatchAll(replay.ResponseBody))
+		for v := range newValues {
+			if !oldValues[v] {
+				diff.NewMatches = append(diff.NewMatches, v)
+			}
+		}
+		for v := range oldValues {
+			if !newValues[v] {
+				diff.GoneMatches = append(diff.GoneMatches, v)
+			}
+		}
+		sort.Strings(diff.NewMatches)
+		sort.Strings(diff.GoneMatches)
+	}
+	return diff
+}
+
+func matchValues(matches []Match) map[string]bool {
+	values := make(map[string]bool, len(matches))
+	for _, m := range matches {
+		values[m.Value] = true
+	}
+	return values
+}
+
+// 忽略每次请求都会变化的响应头
+var volatileHeaders = map[string]bool{
+	"Date":           true,
+	"Age":            true,
+	"Expires":        true,
+	"X-Request-Id":   true,
+	"Cf-Ray":         true,
+	"Set-Cookie":     true,
+	"Content-Length": true,
+}
+
+func diffHeaders(oldHeader, newHeader http.Header) []string {
+	var changes []string
+	for k, v := range oldHeader {
+		if volatileHeaders[k] {
+			continue
+		}
+		newValue, ok := newHeader[k]
+		if !ok {
+			changes = append(changes, "- "+k+": "+strings.Join(v, ", "))
+		} else if strings.Join(v, ", ") != strings.Join(newValue, ", ") {
+			changes = append(changes, "~ "+k+": "+strings.Join(v, ", ")+" => "+strings.Join(newValue, ", "))
+		}
+	}
+	for k, v := range newHeader {
+		if volatileHeaders[k] {
+			continue
+		}
+		if _, ok := oldHeader[k]; !ok {
+			changes = append(changes, "+ "+k+": "+strings.Join(v, ", "))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
@@ -0,0 +1,250 @@
+package fuzhu
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// 规则检查发现的问题类型
+const (
+	RuleProblemCompile       = "compile"        // 正则无法编译
+	RuleProblemMissed        = "missed"         // 正例没有命中
+	RuleProblemFalsePositive = "false-positive" // 反例或负样本语料被命中
+	RuleProblemDuplicate     = "duplicate"      // 与其他规则的名称或正则相同
+	RuleProblemOverlap       = "overlap"        // 其他规则也命中了该规则的正例
+	RuleProblemNoisy         = "noisy"          // 命中了过多的语料文件
+	RuleProblemNoExamples    = "no-examples"
+)
+
+const (
+	// 语料路径中包含这个目录名的文件不应被任何规则命中
+	NegativeCorpusDir = "negative"
+	// 语料文件数不少于这个值时才检查规则是否过于宽泛
+	noisyMinFiles = 10
+	// 命中超过这个比例的语料文件视为过于宽泛
+	noisyRatio = 0.5
+)
+
+// 规则检查发现的问题
+type RuleProblem struct {
+	Rule   string `json:"rule"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+	Other  string `json:"other,omitempty"` // 重复或重叠的另一条规则
+}
+
+// IsError 判断问题是否会让检查失败，重叠、宽泛和缺少样例只是提示
+func (p RuleProblem) IsError() bool {
+	switch p.Kind {
+	case RuleProblemOverlap, RuleProblemNoisy, RuleProblemNoExamples:
+		return false
+	}
+	return true
+}
+
+// 单条规则的检查结果
+type RuleTestResult struct {
+	Rule           string `json:"rule"`
+	Compiled       bool   `json:"compiled"`
+	Positives      int    `json:"positives"`
+	PositivePassed int    `json:"positive_passed"`
+	Negatives      int    `json:"negatives"`
+	NegativePassed int    `json:"negative_passed"`
+	CorpusHits     int    `json:"corpus_hits"` // 命中的语料文件数
+	NegativeHits   int    `json:"negative_hits"`
+}
+
+// 规则检查报告
+type RuleTestReport struct {
+	Results       []RuleTestResult `json:"results"`
+	Problems      []RuleProblem    `json:"problems"`
+	CorpusFiles   int              `json:"corpus_files"`
+	NegativeFiles int              `json:"negative_files"`
+}
+
+// Failed 判断是否存在会让检查失败的问题
+func (r *RuleTestReport) Failed() bool {
+	return slices.ContainsFunc(r.Problems, RuleProblem.IsError)
+}
+
+// 语料文件
+type CorpusFile struct {
+	Path     string
+	Data     []byte
+	Negative bool
+}
+
+// LoadCorpus 读取目录下的所有文件，路径中包含 negative 目录的作为负样本，超过默认大小上限的文件跳过
+func LoadCorpus(dir string) ([]CorpusFile, error) {
+	var files []CorpusFile
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > DefaultRuleMaxBodySize {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+		files = append(files, CorpusFile{
+			Path:     rel,
+			Data:     data,
+			Negative: slices.Contains(strings.Split(rel, "/"), NegativeCorpusDir),
+		})
+		return nil
+	})
+	return files, err
+}
+
+// TestRules 用规则自带的正例、反例和语料检查规则：
+// 编译失败、正例未命中、反例或负样本被命中、名称或正则重复、与其他规则重叠、命中过多语料
+func TestRules(rules []Rule, corpus []CorpusFile) *RuleTestReport {
+	report := &RuleTestReport{Results: make([]RuleTestResult, len(rules))}
+	all := NewRegexManager()
+	results := make(map[string]*RuleTestResult)
+	problem := func(rule, kind, other, format string, args ...interface{}) {
+		report.Problems = append(report.Problems, RuleProblem{Rule: rule, Kind: kind, Other: other, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	names := make(map[string]bool)
+	patterns := make(map[string]string)
+	for i := range rules {
+		rule := rules[i]
+		if rule.Name == "" {
+			rule.Name = rule.Pattern
+		}
+		result := &report.Results[i]
+		result.Rule = rule.Name
+
+		if names[rule.Name] {
+			problem(rule.Name, RuleProblemDuplicate, rule.Name, "规则名称重复")
+		}
+		names[rule.Name] = true
+		pattern := rule.KeyPattern + "\x00" + rule.Pattern
+		if other, ok := patterns[pattern]; ok {
+			problem(rule.Name, RuleProblemDuplicate, other, "与 %s 的正则相同", other)
+		} else {
+			patterns[pattern] = rule.Name
+		}
+
+		single := NewRegexManager()
+		if err := single.AddRule(rule); err != nil {
+			problem(rule.Name, RuleProblemCompile, "", "%v", err)
+			continue
+		}
+		all.AddRule(rule)
+		result.Compiled = true
+		// 同名规则的语料统计合并到第一条
+		if _, ok := results[rule.Name]; !ok {
+			results[rule.Name] = result
+		}
+
+		if len(rule.Examples) == 0 && len(rule.NegativeExamples) == 0 {
+			problem(rule.Name, RuleProblemNoExamples, "", "没有正例和反例")
+		}
+		result.Positives = len(rule.Examples)
+		for _, example := range rule.Examples {
+			if len(single.matchExample(rule, example)) > 0 {
+				result.PositivePassed++
+			} else {
+				problem(rule.Name, RuleProblemMissed, "", "正例未命中: %s", truncateExample(example))
+			}
+		}
+		result.Negatives = len(rule.NegativeExamples)
+		for _, example := range rule.NegativeExamples {
+			if matches := single.matchExample(rule, example); len(matches) > 0 {
+				problem(rule.Name, RuleProblemFalsePositive, "", "反例被命中: %s", truncateExample(matches[0].Value))
+			} else {
+				result.NegativePassed++
+			}
+		}
+	}
+
+	// 其他规则命中同一正例说明规则之间有重叠，每对规则只报告一次
+	overlaps := make(map[string]bool)
+	for _, rule := range rules {
+		for _, example := range rule.Examples {
+			for _, m := range all.matchText([]byte(example)) {
+				pair := rule.Name + "\x00" + m.Rule
+				if m.Rule == rule.Name || overlaps[pair] {
+					continue
+				}
+				overlaps[pair] = true
+				problem(rule.Name, RuleProblemOverlap, m.Rule, "%s 也命中了正例: %s", m.Rule, truncateExample(m.Value))
+			}
+		}
+	}
+
+	positiveFiles := make(map[string]int)
+	for _, f := range corpus {
+		if f.Negative {
+			report.NegativeFiles++
+		} else {
+			report.CorpusFiles++
+		}
+		hit := make(map[string]bool)
+		for _, m := range all.matchText(f.Data) {
+			if hit[m.Rule] {
+				continue
+			}
+			hit[m.Rule] = true
+			result := results[m.Rule]
+			if f.Negative {
+				result.NegativeHits++
+				problem(m.Rule, RuleProblemFalsePositive, "", "负样本 %s 被命中: %s", f.Path, truncateExample(m.Value))
+			} else {
+				result.CorpusHits++
+				positiveFiles[m.Rule]++
+			}
+		}
+	}
+	if report.CorpusFiles >= noisyMinFiles {
+		for _, result := range report.Results {
+			if n := positiveFiles[result.Rule]; float64(n) > float64(report.CorpusFiles)*noisyRatio {
+				problem(result.Rule, RuleProblemNoisy, "", "命中了 %d/%d 个语料文件", n, report.CorpusFiles)
+				delete(positiveFiles, result.Rule)
+			}
+		}
+	}
+	return report
+}
+
+// 键名规则的样例是 JSON 或 XML 文档，按结构化扫描执行，其他规则直接匹配文本
+func (rm *RegexManager) matchExample(rule Rule, example string) []Match {
+	if rule.KeyPattern == "" {
+		return rm.MatchAll([]byte(example))
+	}
+	values, ok := WalkStructured([]byte(example), "")
+	if !ok {
+		return nil
+	}
+	return rm.MatchStructured(values)
+}
+
+// 按代理扫描的方式匹配文本，内容是 JSON 或 XML 时同时按键名扫描
+func (rm *RegexManager) matchText(data []byte) []Match {
+	matches := rm.MatchAll(data)
+	if values, ok := WalkStructured(data, ""); ok {
+		matches = MergeStructured(matches, rm.MatchStructured(values))
+	}
+	return matches
+}
+
+func truncateExample(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > 60 {
+		return string(r[:57]) + "..."
+	}
+	return s
+}
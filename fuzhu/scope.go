@@ -0,0 +1,135 @@
+package fuzhu
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 扫描范围，Include 不为空且启用时只扫描其中的域名，Exclude 中的域名始终跳过
+type ScopeManager struct {
+	enabled bool
+	include map[string]bool
+	exclude map[string]bool
+	mu      sync.RWMutex
+}
+
+// 范围配置，用于查询和整体替换
+type ScopeConfig struct {
+	Enabled bool     `json:"enabled"`
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+func NewScopeManager(exclude []string) *ScopeManager {
+	sm := &ScopeManager{
+		include: make(map[string]bool),
+		exclude: make(map[string]bool),
+	}
+	for _, d := range exclude {
+		sm.exclude[normalizeDomain(d)] = true
+	}
+	return sm
+}
+
+func normalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(domain, "*.")
+	return strings.TrimPrefix(domain, ".")
+}
+
+// 去掉端口，转为小写
+func normalizeHost(host string) string {
+	if i := strings.LastIndex(host, ":"); i != -1 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+	return strings.ToLower(host)
+}
+
+// 判断 host 是否等于 domain 或为其子域名
+func matchDomain(host string, domains map[string]bool) bool {
+	for {
+		if domains[host] {
+			return true
+		}
+		i := strings.Index(host, ".")
+		if i == -1 {
+			return false
+		}
+		host = host[i+1:]
+	}
+}
+
+func (sm *ScopeManager) InScope(host string) bool {
+	host = normalizeHost(host)
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if matchDomain(host, sm.exclude) {
+		return false
+	}
+	if sm.enabled && len(sm.include) > 0 {
+		return matchDomain(host, sm.include)
+	}
+	return true
+}
+
+// Excluded 判断 host 是否在排除列表中，不考虑包含列表
+func (sm *ScopeManager) Excluded(host string) bool {
+	host = normalizeHost(host)
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return matchDomain(host, sm.exclude)
+}
+
+func (sm *ScopeManager) SetEnabled(enabled bool) {
+	sm.mu.Lock()
+	sm.enabled = enabled
+	sm.mu.Unlock()
+}
+
+func (sm *ScopeManager) Include(domain string) {
+	sm.mu.Lock()
+	sm.include[normalizeDomain(domain)] = true
+	sm.mu.Unlock()
+}
+
+func (sm *ScopeManager) Exclude(domain string) {
+	sm.mu.Lock()
+	sm.exclude[normalizeDomain(domain)] = true
+	sm.mu.Unlock()
+}
+
+func (sm *ScopeManager) Config() ScopeConfig {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return ScopeConfig{
+		Enabled: sm.enabled,
+		Include: sortedKeys(sm.include),
+		Exclude: sortedKeys(sm.exclude),
+	}
+}
+
+func (sm *ScopeManager) SetConfig(cfg ScopeConfig) {
+	include := make(map[string]bool, len(cfg.Include))
+	for _, d := range cfg.Include {
+		include[normalizeDomain(d)] = true
+	}
+	exclude := make(map[string]bool, len(cfg.Exclude))
+	for _, d := range cfg.Exclude {
+		exclude[normalizeDomain(d)] = true
+	}
+	sm.mu.Lock()
+	sm.enabled = cfg.Enabled
+	sm.include = include
+	sm.exclude = exclude
+	sm.mu.Unlock()
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,29 @@
+package fuzhu
+
+import "strings"
+
+// 严重程度，从高到低
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+	SeverityInfo     = "info"
+)
+
+var Severities = []string{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo}
+
+// SeverityRank 返回严重程度的等级，越大越严重，未知的按 medium 处理
+func SeverityRank(severity string) int {
+	switch strings.ToLower(severity) {
+	case SeverityCritical:
+		return 4
+	case SeverityHigh:
+		return 3
+	case SeverityLow:
+		return 1
+	case SeverityInfo:
+		return 0
+	}
+	return 2
+}
@@ -5,21 +5,45 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 )
 
 var (
-	quitChan    = make(chan os.Signal, 1)
-	outputMutex sync.Mutex
+	quitChan        = make(chan os.Signal, 1)
+	outputMutex     sync.Mutex
+	shutdownHandler atomic.Pointer[func()]
 )
 
+// RequestShutdown 主动触发与 Ctrl+C 相同的关闭流程
+func RequestShutdown() {
+	select {
+	case quitChan <- os.Interrupt:
+	default:
+	}
+}
+
+// SetShutdownHandler 设置收到退出信号后执行的关闭流程，返回后进程退出
+func SetShutdownHandler(fn func()) {
+	shutdownHandler.Store(&fn)
+}
+
 func handleInterrupt() {
 	signal.Notify(quitChan, os.Interrupt, syscall.SIGTERM)
 	<-quitChan
 	outputMutex.Lock()
 	logger.Warn("正在关闭代理服务器...")
-	logger.Sync()
 	outputMutex.Unlock()
-	close(quitChan)
+	if fn := shutdownHandler.Load(); fn != nil {
+		// 关闭过程中再次收到信号时强制退出
+		go func() {
+			<-quitChan
+			logger.Warn("强制退出")
+			logger.Flush()
+			os.Exit(1)
+		}()
+		(*fn)()
+	}
+	logger.Flush()
 	os.Exit(0)
 }
@@ -0,0 +1,228 @@
+package fuzhu
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// 按文件头识别出的内容类别
+const (
+	ContentImage      = "image"
+	ContentFont       = "font"
+	ContentMedia      = "media" // 音频和视频
+	ContentPDF        = "pdf"
+	ContentOffice     = "office"
+	ContentArchive    = "archive"
+	ContentWasm       = "wasm"
+	ContentExecutable = "executable"
+	ContentText       = "text"
+	ContentBinary     = "binary" // 无法识别的二进制数据
+)
+
+// 识别内容时最多查看的字节数
+const SniffLen = 4096
+
+// 按文件头识别的内容类型，Kind 为空表示没有数据
+type ContentClass struct {
+	Kind string `json:"kind"`
+	MIME string `json:"mime,omitempty"`
+	Ext  string `json:"ext,omitempty"`
+}
+
+// 文件头签名，offset 处的字节与 magic 相同即匹配
+type magicSignature struct {
+	offset int
+	magic  string
+	class  ContentClass
+}
+
+var magicSignatures = []magicSignature{
+	{0, "\x89PNG\r\n\x1a\n", ContentClass{ContentImage, "image/png", ".png"}},
+	{0, "\xff\xd8\xff", ContentClass{ContentImage, "image/jpeg", ".jpg"}},
+	{0, "GIF87a", ContentClass{ContentImage, "image/gif", ".gif"}},
+	{0, "GIF89a", ContentClass{ContentImage, "image/gif", ".gif"}},
+	{0, "II*\x00", ContentClass{ContentImage, "image/tiff", ".tif"}},
+	{0, "MM\x00*", ContentClass{ContentImage, "image/tiff", ".tif"}},
+	{0, "\x00\x00\x01\x00", ContentClass{ContentImage, "image/x-icon", ".ico"}},
+	{4, "ftypavif", ContentClass{ContentImage, "image/avif", ".avif"}},
+	{4, "ftypheic", ContentClass{ContentImage, "image/heic", ".heic"}},
+	{0, "wOFF", ContentClass{ContentFont, "font/woff", ".woff"}},
+	{0, "wOF2", ContentClass{ContentFont, "font/woff2", ".woff2"}},
+	{0, "OTTO", ContentClass{ContentFont, "font/otf", ".otf"}},
+	{0, "\x00\x01\x00\x00\x00", ContentClass{ContentFont, "font/ttf", ".ttf"}},
+	{0, "ID3", ContentClass{ContentMedia, "audio/mpeg", ".mp3"}},
+	{0, "OggS", ContentClass{ContentMedia, "audio/ogg", ".ogg"}},
+	{0, "fLaC", ContentClass{ContentMedia, "audio/flac", ".flac"}},
+	{0, "\x1a\x45\xdf\xa3", ContentClass{ContentMedia, "video/webm", ".webm"}},
+	{4, "ftyp", ContentClass{ContentMedia, "video/mp4", ".mp4"}},
+	{0, "%PDF-", ContentClass{ContentPDF, "application/pdf", ".pdf"}},
+	// 无法区分 doc、xls、ppt，统一按 .doc 保存
+	{0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", ContentClass{ContentOffice, "application/msword", ".doc"}},
+	{0, "PK\x03\x04", ContentClass{ContentArchive, "application/zip", ".zip"}},
+	{0, "PK\x05\x06", ContentClass{ContentArchive, "application/zip", ".zip"}},
+	{0, "\x1f\x8b", ContentClass{ContentArchive, "application/gzip", ".gz"}},
+	{0, "7z\xbc\xaf\x27\x1c", ContentClass{ContentArchive, "application/x-7z-compressed", ".7z"}},
+	{0, "Rar!\x1a\x07", ContentClass{ContentArchive, "application/vnd.rar", ".rar"}},
+	{0, "BZh", ContentClass{ContentArchive, "application/x-bzip2", ".bz2"}},
+	{0, "\xfd7zXZ\x00", ContentClass{ContentArchive, "application/x-xz", ".xz"}},
+	{0, "\x28\xb5\x2f\xfd", ContentClass{ContentArchive, "application/zstd", ".zst"}},
+	{257, "ustar", ContentClass{ContentArchive, "application/x-tar", ".tar"}},
+	{0, "\x00asm", ContentClass{ContentWasm, "application/wasm", ".wasm"}},
+	{0, "\x7fELF", ContentClass{ContentExecutable, "application/x-executable", ".elf"}},
+	{0, "MZ", ContentClass{ContentExecutable, "application/vnd.microsoft.portable-executable", ".exe"}},
+	{0, "\xfe\xed\xfa\xce", ContentClass{ContentExecutable, "application/x-mach-binary", ".macho"}},
+	{0, "\xfe\xed\xfa\xcf", ContentClass{ContentExecutable, "application/x-mach-binary", ".macho"}},
+	{0, "\xce\xfa\xed\xfe", ContentClass{ContentExecutable, "application/x-mach-binary", ".macho"}},
+	{0, "\xcf\xfa\xed\xfe", ContentClass{ContentExecutable, "application/x-mach-binary", ".macho"}},
+}
+
+// zip 中的这些文件说明是 Office 文档、安装包或 jar
+var zipMarkers = []struct {
+	name  string
+	class ContentClass
+}{
+	{"word/", ContentClass{ContentOffice, "application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx"}},
+	{"xl/", ContentClass{ContentOffice, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx"}},
+	{"ppt/", ContentClass{ContentOffice, "application/vnd.openxmlformats-officedocument.presentationml.presentation", ".pptx"}},
+	{"AndroidManifest.xml", ContentClass{ContentArchive, "application/vnd.android.package-archive", ".apk"}},
+	{"META-INF/MANIFEST.MF", ContentClass{ContentArchive, "application/java-archive", ".jar"}},
+}
+
+// SniffContent 按文件头识别内容类型，不是已知格式时按是否为 UTF-8 文本区分 text 和 binary
+func SniffContent(data []byte) ContentClass {
+	if len(data) == 0 {
+		return ContentClass{}
+	}
+	head := data
+	if len(head) > SniffLen {
+		head = head[:SniffLen]
+	}
+	for _, sig := range magicSignatures {
+		if len(head) < sig.offset+len(sig.magic) || string(head[sig.offset:sig.offset+len(sig.magic)]) != sig.magic {
+			continue
+		}
+		switch {
+		case sig.class.MIME == "application/zip":
+			return sniffZip(head)
+		case sig.magic == "MZ" && !isPE(head):
+			continue
+		}
+		return sig.class
+	}
+	// WebP、WAV、AVI 共用 RIFF 头
+	if len(head) >= 12 && string(head[:4]) == "RIFF" {
+		switch string(head[8:12]) {
+		case "WEBP":
+			return ContentClass{ContentImage, "image/webp", ".webp"}
+		case "WAVE":
+			return ContentClass{ContentMedia, "audio/wav", ".wav"}
+		case "AVI ":
+			return ContentClass{ContentMedia, "video/x-msvideo", ".avi"}
+		}
+	}
+	if isText(head) {
+		return ContentClass{Kind: ContentText}
+	}
+	return ContentClass{Kind: ContentBinary}
+}
+
+func sniffZip(head []byte) ContentClass {
+	for _, m := range zipMarkers {
+		if bytes.Contains(head, []byte(m.name)) {
+			return m.class
+		}
+	}
+	if bytes.Contains(head, []byte("[Content_Types].xml")) {
+		return ContentClass{ContentOffice, "application/zip", ".zip"}
+	}
+	return ContentClass{ContentArchive, "application/zip", ".zip"}
+}
+
+// MZ 头很短，能看到 PE 头时再确认一次
+func isPE(head []byte) bool {
+	if len(head) < 64 {
+		return true
+	}
+	offset := int(head[60]) | int(head[61])<<8 | int(head[62])<<16 | int(head[63])<<24
+	// PE 头在文件开头附近，偏移超出识别范围说明只是以 MZ 开头的普通内容
+	if offset < 64 || offset+4 > SniffLen {
+		return false
+	}
+	if offset+4 > len(head) {
+		return true
+	}
+	return string(head[offset:offset+4]) == "PE\x00\x00"
+}
+
+// 不含 NUL 且是合法 UTF-8 的视为文本，结尾被截断的多字节字符不算错误
+func isText(head []byte) bool {
+	if bytes.IndexByte(head, 0) != -1 {
+		return false
+	}
+	for len(head) > 0 {
+		r, size := utf8.DecodeRune(head)
+		if r == utf8.RuneError && size == 1 {
+			return len(head) < utf8.UTFMax && !utf8.FullRune(head)
+		}
+		head = head[size:]
+	}
+	return true
+}
+
+// DeclaredKind 返回 Content-Type 声明的内容类别，没有声明或为通用二进制类型时返回空
+func DeclaredKind(contentType string) string {
+	ct := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	switch {
+	case ct == "", ct == "application/octet-stream", ct == "binary/octet-stream":
+		return ""
+	case ct == "image/svg+xml":
+		return ContentText
+	case strings.HasPrefix(ct, "image/"):
+		return ContentImage
+	case strings.HasPrefix(ct, "font/"), strings.Contains(ct, "font"):
+		return ContentFont
+	case strings.HasPrefix(ct, "video/"), strings.HasPrefix(ct, "audio/"):
+		return ContentMedia
+	case ct == "application/pdf":
+		return ContentPDF
+	case strings.Contains(ct, "msword"), strings.Contains(ct, "ms-excel"), strings.Contains(ct, "ms-powerpoint"),
+		strings.Contains(ct, "officedocument"):
+		return ContentOffice
+	case ct == "application/wasm":
+		return ContentWasm
+	case strings.Contains(ct, "zip"), strings.Contains(ct, "compressed"), strings.Contains(ct, "x-tar"),
+		strings.Contains(ct, "rar"), strings.Contains(ct, "java-archive"), strings.Contains(ct, "android.package"):
+		return ContentArchive
+	case strings.Contains(ct, "msdownload"), strings.Contains(ct, "executable"), strings.Contains(ct, "mach-binary"):
+		return ContentExecutable
+	case strings.HasPrefix(ct, "text/"), strings.Contains(ct, "json"), strings.Contains(ct, "javascript"),
+		strings.Contains(ct, "xml"), strings.Contains(ct, "html"), strings.Contains(ct, "x-www-form-urlencoded"):
+		return ContentText
+	}
+	return ""
+}
+
+// ContentMismatch 判断 Content-Type 声明的类别与实际内容是否不符，
+// 返回声明的类别；无法识别的二进制数据和 zip 与 Office 文档之间不算不符
+func ContentMismatch(contentType string, sniffed ContentClass) (string, bool) {
+	declared := DeclaredKind(contentType)
+	switch {
+	case declared == "", sniffed.Kind == "", sniffed.Kind == ContentBinary, declared == sniffed.Kind:
+		return declared, false
+	case declared == ContentArchive && sniffed.Kind == ContentOffice, declared == ContentOffice && sniffed.Kind == ContentArchive:
+		return declared, false
+	}
+	return declared, true
+}
+
+// MismatchSeverity 返回内容类型不符的严重程度，伪装成其他类型的可执行文件为高危
+func MismatchSeverity(sniffed ContentClass) string {
+	switch sniffed.Kind {
+	case ContentExecutable, ContentWasm:
+		return SeverityHigh
+	case ContentText:
+		return SeverityLow
+	}
+	return SeverityMedium
+}
@@ -0,0 +1,169 @@
+package fuzhu
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var sourceMappingURLRe = regexp.MustCompile(`(?m)^[ \t]*(?://|/\*)[#@][ \t]*sourceMappingURL=([^\s*]+)`)
+
+// source map v3 中需要的字段
+type SourceMap struct {
+	Version        int       `json:"version"`
+	File           string    `json:"file"`
+	SourceRoot     string    `json:"sourceRoot"`
+	Sources        []string  `json:"sources"`
+	SourcesContent []*string `json:"sourcesContent"`
+	Mappings       string    `json:"mappings"`
+}
+
+// 从 sourcesContent 还原出的源文件
+type SourceFile struct {
+	Path    string
+	Content []byte
+}
+
+// FindSourceMapURL 从 SourceMap/X-SourceMap 响应头或 sourceMappingURL 注释中找出 source map 地址，
+// 相对地址按 JS 地址解析，内联的 data: 地址原样返回
+func FindSourceMapURL(header http.Header, body []byte, jsURL string) string {
+	ref := header.Get("SourceMap")
+	if ref == "" {
+		ref = header.Get("X-SourceMap")
+	}
+	if ref == "" {
+		// 以最后一个注释为准
+		all := sourceMappingURLRe.FindAllSubmatch(body, -1)
+		if len(all) == 0 {
+			return ""
+		}
+		ref = string(all[len(all)-1][1])
+	}
+	if strings.HasPrefix(ref, "data:") {
+		return ref
+	}
+	base, err := url.Parse(jsURL)
+	if err != nil {
+		return ref
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(u).String()
+}
+
+// IsSourceMap 根据地址和内容判断是否为 source map
+func IsSourceMap(rawURL string, body []byte) bool {
+	if u, err := url.Parse(rawURL); err == nil && strings.HasSuffix(u.Path, ".map") {
+		return true
+	}
+	head := body
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	// 有的 source map 以 )]}' 开头防止 JSON 劫持
+	head = bytes.TrimPrefix(bytes.TrimSpace(head), []byte(")]}'"))
+	return bytes.HasPrefix(bytes.TrimSpace(head), []byte("{")) &&
+		bytes.Contains(head, []byte(`"version"`)) &&
+		(bytes.Contains(head, []byte(`"sources"`)) || bytes.Contains(head, []byte(`"mappings"`)))
+}
+
+// ParseSourceMap 解析 source map，支持 data:application/json;base64 内联地址
+func ParseSourceMap(data []byte) (*SourceMap, error) {
+	if bytes.HasPrefix(data, []byte("data:")) {
+		i := bytes.IndexByte(data, ',')
+		if i == -1 {
+			return nil, errors.New("invalid data url")
+		}
+		payload := data[i+1:]
+		if bytes.Contains(data[:i], []byte(";base64")) {
+			decoded, err := base64.StdEncoding.DecodeString(string(payload))
+			if err != nil {
+				return nil, err
+			}
+			payload = decoded
+		} else if unescaped, err := url.PathUnescape(string(payload)); err == nil {
+			payload = []byte(unescaped)
+		}
+		data = payload
+	}
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte(")]}'"))
+	var sm SourceMap
+	if err := json.Unmarshal(data, &sm); err != nil {
+		return nil, err
+	}
+	if sm.Version != 3 || len(sm.Sources) == 0 {
+		return nil, errors.New("not a version 3 source map")
+	}
+	return &sm, nil
+}
+
+// Files 返回带内容的源文件，路径去掉 webpack:// 等前缀并清理为相对路径
+func (sm *SourceMap) Files() []SourceFile {
+	var files []SourceFile
+	seen := make(map[string]bool)
+	for i, src := range sm.Sources {
+		if i >= len(sm.SourcesContent) || sm.SourcesContent[i] == nil {
+			continue
+		}
+		p := cleanSourcePath(sm.SourceRoot, src)
+		for n := 2; seen[p]; n++ {
+			p = fmt.Sprintf("%s~%d", cleanSourcePath(sm.SourceRoot, src), n)
+		}
+		seen[p] = true
+		files = append(files, SourceFile{Path: p, Content: []byte(*sm.SourcesContent[i])})
+	}
+	return files
+}
+
+// 把 source map 中的路径转为不含 .. 的相对路径
+func cleanSourcePath(root, src string) string {
+	if i := strings.IndexAny(src, "?#"); i != -1 {
+		src = src[:i]
+	}
+	// webpack:///./src/a.js、webpack://app/./src/a.js，项目名或主机名保留为目录
+	if i := strings.Index(src, "://"); i != -1 {
+		src = src[i+3:]
+	}
+	if root != "" && !strings.Contains(root, "://") {
+		src = root + "/" + src
+	}
+	p := path.Clean("/" + src)
+	p = strings.TrimPrefix(p, "/")
+	if p == "" || p == "." {
+		p = "unknown"
+	}
+	return p
+}
+
+// SaveSources 把源文件保存到 dir/host/ 下，返回保存的文件数
+func SaveSources(dir, host string, files []SourceFile) (int, error) {
+	host = strings.NewReplacer(":", "_", "/", "_", `\`, "_").Replace(host)
+	base := filepath.Join(dir, host)
+	saved := 0
+	for _, f := range files {
+		target := filepath.Join(base, filepath.FromSlash(f.Path))
+		// 路径已经清理过，这里再确认不会写到目录外
+		if !strings.HasPrefix(target, base+string(filepath.Separator)) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return saved, err
+		}
+		if err := os.WriteFile(target, f.Content, 0644); err != nil {
+			return saved, err
+		}
+		saved++
+	}
+	return saved, nil
+}
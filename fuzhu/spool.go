@@ -0,0 +1,253 @@
+package fuzhu
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 溢出目录写满时的丢弃策略
+const (
+	SpoolDropOldest = "oldest"          // 丢弃最早写入的
+	SpoolDropNewest = "newest"          // 丢弃新来的
+	SpoolDropLowest = "lowest-priority" // 丢弃优先级最低的，同优先级丢弃最早的
+)
+
+var SpoolPolicies = []string{SpoolDropOldest, SpoolDropNewest, SpoolDropLowest}
+
+// 策略以外的丢弃原因
+const (
+	SpoolDropTooLarge = "too-large" // 单项超过溢出目录上限
+	SpoolDropError    = "error"     // 读写失败
+)
+
+var ErrSpoolClosed = errors.New("spool is closed")
+
+// 内容的扫描优先级，越大越优先保留
+const (
+	PriorityLow    = 0 // 样式、字体、二进制等
+	PriorityNormal = 1 // HTML、XML、纯文本
+	PriorityHigh   = 2 // JS、JSON、source map，最可能包含密钥和端点
+)
+
+// ContentPriority 按内容类型和地址判断扫描优先级
+func ContentPriority(contentType, rawURL string) int {
+	ct := strings.ToLower(contentType)
+	path := strings.ToLower(strings.SplitN(rawURL, "?", 2)[0])
+	switch {
+	case strings.Contains(ct, "javascript"), strings.Contains(ct, "json"),
+		strings.HasSuffix(path, ".js"), strings.HasSuffix(path, ".map"):
+		return PriorityHigh
+	case strings.HasPrefix(ct, "text/html"), strings.Contains(ct, "xml"),
+		strings.HasPrefix(ct, "text/plain"), ct == "":
+		return PriorityNormal
+	}
+	return PriorityLow
+}
+
+// 溢出目录中的一项，文件名为 序号-优先级.json
+type spoolItem struct {
+	seq      int64
+	priority int
+	size     int64
+}
+
+// 溢出队列的统计
+type SpoolStats struct {
+	Items   int              `json:"items"`
+	Bytes   int64            `json:"bytes"`
+	Dropped map[string]int64 `json:"dropped"` // 按丢弃原因计数
+}
+
+// 磁盘溢出队列，内存队列满时把数据写到目录中，按写入顺序取出，重启后继续
+type Spool struct {
+	dir      string
+	maxBytes int64
+	policy   string
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	items   []spoolItem         // 按序号排列
+	popped  map[int64]spoolItem // 已取出但还没有处理完的项，文件仍在目录中
+	bytes   int64
+	nextSeq int64
+	dropped map[string]int64
+	closed  bool
+}
+
+// OpenSpool 打开溢出目录，已有的数据会被重新加载
+func OpenSpool(dir string, maxBytes int64, policy string) (*Spool, error) {
+	if !slices.Contains(SpoolPolicies, policy) {
+		return nil, fmt.Errorf("unknown spool policy %q", policy)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Spool{dir: dir, maxBytes: maxBytes, policy: policy, popped: make(map[int64]spoolItem), dropped: make(map[string]int64)}
+	s.cond = sync.NewCond(&s.mu)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		// 写了一半的临时文件
+		if strings.HasSuffix(name, ".tmp") {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		seqStr, priStr, ok := strings.Cut(strings.TrimSuffix(name, ".json"), "-")
+		seq, err1 := strconv.ParseInt(seqStr, 10, 64)
+		priority, err2 := strconv.Atoi(priStr)
+		info, err3 := e.Info()
+		if !ok || !strings.HasSuffix(name, ".json") || err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		s.items = append(s.items, spoolItem{seq: seq, priority: priority, size: info.Size()})
+		s.bytes += info.Size()
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(s.items, func(i, j int) bool { return s.items[i].seq < s.items[j].seq })
+	return s, nil
+}
+
+func (s *Spool) path(item spoolItem) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%012d-%d.json", item.seq, item.priority))
+}
+
+// Push 写入一项，空间不足时按策略丢弃，返回丢弃的项数（包括没有写入的这一项）和丢弃原因
+func (s *Spool) Push(data []byte, priority int) (int, string, error) {
+	size := int64(len(data))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 1, SpoolDropError, ErrSpoolClosed
+	}
+	if size > s.maxBytes {
+		s.dropped[SpoolDropTooLarge]++
+		return 1, SpoolDropTooLarge, nil
+	}
+
+	// 先选出要丢弃的项，确认能腾出空间后再删除
+	var victims []int
+	need := s.bytes + size - s.maxBytes
+	switch s.policy {
+	case SpoolDropOldest:
+		for i := 0; need > 0 && i < len(s.items); i++ {
+			victims = append(victims, i)
+			need -= s.items[i].size
+		}
+	case SpoolDropLowest:
+		order := make([]int, len(s.items))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool { return s.items[order[a]].priority < s.items[order[b]].priority })
+		for _, i := range order {
+			if need <= 0 || s.items[i].priority > priority {
+				break
+			}
+			victims = append(victims, i)
+			need -= s.items[i].size
+		}
+	}
+	if need > 0 {
+		s.dropped[s.policy]++
+		return 1, s.policy, nil
+	}
+
+	sort.Ints(victims)
+	for n := len(victims) - 1; n >= 0; n-- {
+		item := s.items[victims[n]]
+		os.Remove(s.path(item))
+		s.bytes -= item.size
+		s.items = slices.Delete(s.items, victims[n], victims[n]+1)
+	}
+	s.dropped[s.policy] += int64(len(victims))
+
+	item := spoolItem{seq: s.nextSeq, priority: priority, size: size}
+	target := s.path(item)
+	if err := os.WriteFile(target+".tmp", data, 0644); err != nil {
+		s.dropped[SpoolDropError]++
+		return len(victims) + 1, SpoolDropError, err
+	}
+	if err := os.Rename(target+".tmp", target); err != nil {
+		s.dropped[SpoolDropError]++
+		return len(victims) + 1, SpoolDropError, err
+	}
+	s.nextSeq++
+	s.items = append(s.items, item)
+	s.bytes += size
+	s.cond.Signal()
+	return len(victims), s.policy, nil
+}
+
+// Pop 取出最早写入的一项和它的序号，队列为空时阻塞，关闭后返回 ErrSpoolClosed。
+// 文件在调用 Done 后才删除，处理完之前退出的项下次启动时重新取出
+func (s *Spool) Pop() ([]byte, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.items) == 0 && !s.closed {
+		s.cond.Wait()
+	}
+	if s.closed {
+		return nil, 0, ErrSpoolClosed
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	data, err := os.ReadFile(s.path(item))
+	if err != nil {
+		s.bytes -= item.size
+		os.Remove(s.path(item))
+		s.dropped[SpoolDropError]++
+		return nil, 0, err
+	}
+	s.popped[item.seq] = item
+	return data, item.seq, nil
+}
+
+// Done 删除已处理完的项
+func (s *Spool) Done(seq int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.popped[seq]
+	if !ok {
+		return
+	}
+	delete(s.popped, seq)
+	s.bytes -= item.size
+	os.Remove(s.path(item))
+}
+
+// Len 返回队列中的项数
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := SpoolStats{Items: len(s.items), Bytes: s.bytes, Dropped: make(map[string]int64, len(s.dropped))}
+	for reason, n := range s.dropped {
+		stats.Dropped[reason] = n
+	}
+	return stats
+}
+
+// Close 唤醒等待中的 Pop，未取出和未处理完的数据保留在目录中，下次启动时继续处理
+func (s *Spool) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
@@ -0,0 +1,120 @@
+package fuzhu
+
+import (
+	"slices"
+	"testing"
+)
+
+type spoolPush struct {
+	data     string
+	priority int
+}
+
+func popAll(t *testing.T, s *Spool) []string {
+	t.Helper()
+	var got []string
+	for s.Len() > 0 {
+		data, seq, err := s.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(data))
+		s.Done(seq)
+	}
+	return got
+}
+
+func TestSpoolDropPolicies(t *testing.T) {
+	// 每项 10 字节，上限 30 字节，写满三项后再写第四项
+	mixed := []spoolPush{{"a-normal-1", PriorityNormal}, {"b-low----0", PriorityLow}, {"c-high---2", PriorityHigh}}
+	important := []spoolPush{{"a-normal-1", PriorityNormal}, {"c-high---2", PriorityHigh}, {"e-high---2", PriorityHigh}}
+	tests := []struct {
+		name      string
+		policy    string
+		initial   []spoolPush
+		push      spoolPush
+		wantItems []string
+	}{
+		{"oldest", SpoolDropOldest, mixed, spoolPush{"d-normal-1", PriorityNormal}, []string{"b-low----0", "c-high---2", "d-normal-1"}},
+		{"newest", SpoolDropNewest, mixed, spoolPush{"d-normal-1", PriorityNormal}, []string{"a-normal-1", "b-low----0", "c-high---2"}},
+		{"lowest drops lowest", SpoolDropLowest, mixed, spoolPush{"d-normal-1", PriorityNormal}, []string{"a-normal-1", "c-high---2", "d-normal-1"}},
+		{"lowest same priority drops oldest", SpoolDropLowest, important, spoolPush{"d-normal-1", PriorityNormal}, []string{"c-high---2", "e-high---2", "d-normal-1"}},
+		{"lowest drops new low item", SpoolDropLowest, important, spoolPush{"d-low----0", PriorityLow}, []string{"a-normal-1", "c-high---2", "e-high---2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := OpenSpool(t.TempDir(), 30, tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range tt.initial {
+				if dropped, _, err := s.Push([]byte(p.data), p.priority); err != nil || dropped != 0 {
+					t.Fatalf("Push(%s) = %d, %v", p.data, dropped, err)
+				}
+			}
+			dropped, reason, err := s.Push([]byte(tt.push.data), tt.push.priority)
+			if err != nil || dropped != 1 || reason != tt.policy {
+				t.Fatalf("Push(%s) = %d, %q, %v, want 1 dropped by %s", tt.push.data, dropped, reason, err, tt.policy)
+			}
+			if stats := s.Stats(); stats.Dropped[tt.policy] != 1 || stats.Bytes != 30 {
+				t.Errorf("Stats = %+v", stats)
+			}
+			if got := popAll(t, s); !slices.Equal(got, tt.wantItems) {
+				t.Errorf("items = %v, want %v", got, tt.wantItems)
+			}
+		})
+	}
+}
+
+func TestSpoolTooLarge(t *testing.T) {
+	s, err := OpenSpool(t.TempDir(), 10, SpoolDropOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Push([]byte("small"), PriorityNormal)
+	if dropped, reason, err := s.Push([]byte("much too large"), PriorityHigh); err != nil || dropped != 1 || reason != SpoolDropTooLarge {
+		t.Errorf("Push = %d, %q, %v, want too-large drop", dropped, reason, err)
+	}
+	if got := popAll(t, s); !slices.Equal(got, []string{"small"}) {
+		t.Errorf("items = %v, the existing item should be kept", got)
+	}
+}
+
+func TestSpoolReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenSpool(dir, 100, SpoolDropOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{"one", "two", "three"} {
+		s.Push([]byte(data), PriorityNormal)
+	}
+	// 取出但没有处理完的项在重启后重新取出
+	if data, _, err := s.Pop(); err != nil || string(data) != "one" {
+		t.Fatalf("Pop = %q, %v", data, err)
+	}
+	data, seq, _ := s.Pop()
+	s.Done(seq)
+	if string(data) != "two" {
+		t.Fatalf("Pop = %q, want two", data)
+	}
+	s.Close()
+	if _, _, err := s.Pop(); err != ErrSpoolClosed {
+		t.Errorf("Pop after Close = %v, want ErrSpoolClosed", err)
+	}
+	if _, _, err := s.Push([]byte("four"), PriorityNormal); err != ErrSpoolClosed {
+		t.Errorf("Push after Close = %v, want ErrSpoolClosed", err)
+	}
+
+	reopened, err := OpenSpool(dir, 100, SpoolDropOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.Push([]byte("four"), PriorityNormal)
+	if got, want := popAll(t, reopened), []string{"one", "three", "four"}; !slices.Equal(got, want) {
+		t.Errorf("items after reopen = %v, want %v", got, want)
+	}
+	if stats := reopened.Stats(); stats.Items != 0 || stats.Bytes != 0 {
+		t.Errorf("Stats after draining = %+v", stats)
+	}
+}
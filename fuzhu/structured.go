@@ -0,0 +1,184 @@
+package fuzhu
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// 结构化扫描最多遍历的值数量
+const maxStructuredValues = 100000
+
+// JSON/XML 中的一个值
+type StructuredValue struct {
+	Path  string // JSON pointer 或 XPath
+	Key   string // 所属的键名、元素名或属性名
+	Value string
+}
+
+// WalkStructured 按内容类型或内容开头把数据解析为 JSON 或 XML，返回所有标量值，无法解析时返回 false
+func WalkStructured(data []byte, contentType string) ([]StructuredValue, bool) {
+	ct := strings.ToLower(contentType)
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || strings.Contains(ct, "html") {
+		return nil, false
+	}
+	switch {
+	case strings.Contains(ct, "json") || trimmed[0] == '{' || trimmed[0] == '[':
+		return WalkJSON(trimmed)
+	case strings.Contains(ct, "xml") || bytes.HasPrefix(trimmed, []byte("<?xml")):
+		return WalkXML(trimmed)
+	}
+	return nil, false
+}
+
+// WalkJSON 遍历 JSON，路径为 RFC 6901 JSON pointer
+func WalkJSON(data []byte) ([]StructuredValue, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	var values []StructuredValue
+	walkJSONValue(v, "", "", &values)
+	return values, true
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func walkJSONValue(v interface{}, path, key string, values *[]StructuredValue) {
+	if len(*values) >= maxStructuredValues {
+		return
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			walkJSONValue(child, path+"/"+jsonPointerEscaper.Replace(k), k, values)
+		}
+	case []interface{}:
+		for i, child := range t {
+			// 数组元素沿用数组的键名
+			walkJSONValue(child, fmt.Sprintf("%s/%d", path, i), key, values)
+		}
+	case string:
+		*values = append(*values, StructuredValue{Path: path, Key: key, Value: t})
+	case json.Number:
+		*values = append(*values, StructuredValue{Path: path, Key: key, Value: t.String()})
+	case bool:
+		*values = append(*values, StructuredValue{Path: path, Key: key, Value: fmt.Sprint(t)})
+	}
+}
+
+// WalkXML 遍历 XML 的文本和属性，路径为 XPath，同名兄弟元素从第二个起带下标
+func WalkXML(data []byte) ([]StructuredValue, bool) {
+	type frame struct {
+		path   string
+		name   string
+		counts map[string]int
+		text   strings.Builder
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	stack := []*frame{{counts: make(map[string]int)}}
+	var values []StructuredValue
+	for len(values) < maxStructuredValues {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			parent := stack[len(stack)-1]
+			name := t.Name.Local
+			parent.counts[name]++
+			path := parent.path + "/" + name
+			if n := parent.counts[name]; n > 1 {
+				path = fmt.Sprintf("%s[%d]", path, n)
+			}
+			for _, attr := range t.Attr {
+				values = append(values, StructuredValue{Path: path + "/@" + attr.Name.Local, Key: attr.Name.Local, Value: attr.Value})
+			}
+			stack = append(stack, &frame{path: path, name: name, counts: make(map[string]int)})
+		case xml.CharData:
+			stack[len(stack)-1].text.Write(t)
+		case xml.EndElement:
+			if len(stack) == 1 {
+				return nil, false
+			}
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if text := strings.TrimSpace(f.text.String()); text != "" {
+				values = append(values, StructuredValue{Path: f.path, Key: f.name, Value: text})
+			}
+		}
+	}
+	return values, len(stack) == 1 && len(stack[0].counts) > 0
+}
+
+// MatchStructured 对每个值执行规则：键名规则要求键名和值都匹配，普通规则只匹配值
+// 返回的 Index 相对于值本身，Source 为值。规则在锁内复制，在锁外并发执行
+func (rm *RegexManager) MatchStructured(values []StructuredValue) []Match {
+	return runRules(rm.snapshot(), func(sr ruleSnapshot) []Match {
+		return sr.matchStructured(values)
+	})
+}
+
+func (sr ruleSnapshot) matchStructured(values []StructuredValue) []Match {
+	var matches []Match
+	seen := make(map[string]bool)
+	groupNames := sr.re.SubexpNames()
+	for _, sv := range values {
+		if sr.keyRe != nil && !sr.keyRe.MatchString(sv.Key) {
+			continue
+		}
+		value := []byte(sv.Value)
+		if !sr.stats.allow(&sr.rule, len(value)) {
+			continue
+		}
+		var all [][]int
+		sr.timed(len(value), func() {
+			all = sr.re.FindAllSubmatchIndex(value, -1)
+		})
+		for _, loc := range all {
+			submatch := submatches(value, loc)
+			if len(submatch[0]) == 0 {
+				continue
+			}
+			key := sv.Path + "\x00" + string(submatch[0])
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			m, ok := newMatch(sr.re, sr.rule, groupNames, submatch, loc)
+			if !ok {
+				continue
+			}
+			m.Path, m.Key, m.Source = sv.Path, sv.Key, value
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// MergeStructured 把结构化扫描的结果追加到原始内容的结果后面，
+// 原始内容中已被任一规则找到的值不再重复报告
+func MergeStructured(matches, structured []Match) []Match {
+	found := make(map[string]bool, 2*len(matches))
+	for _, m := range matches {
+		found[m.Value] = true
+		found[m.Secret] = true
+	}
+	for _, m := range structured {
+		if !found[m.Secret] {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,126 @@
+package fuzhu
+
+import (
+	"maps"
+	"testing"
+)
+
+// 路径 -> 键名=值，JSON 对象的遍历顺序不固定
+func structuredMap(values []StructuredValue) map[string]string {
+	m := make(map[string]string, len(values))
+	for _, v := range values {
+		m[v.Path] = v.Key + "=" + v.Value
+	}
+	return m
+}
+
+func TestWalkJSON(t *testing.T) {
+	values, ok := WalkJSON([]byte(`{"user":{"name":"alice","tokens":["t1","t2"]},"a/b":{"c~d":1.50},"ok":true,"none":null}`))
+	if !ok {
+		t.Fatal("WalkJSON failed")
+	}
+	want := map[string]string{
+		"/user/name":     "name=alice",
+		"/user/tokens/0": "tokens=t1",
+		"/user/tokens/1": "tokens=t2",
+		"/a~1b/c~0d":     "c~d=1.50",
+		"/ok":            "ok=true",
+	}
+	if got := structuredMap(values); !maps.Equal(got, want) {
+		t.Errorf("WalkJSON = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{``, `{"a":`, `not json`} {
+		if _, ok := WalkJSON([]byte(bad)); ok {
+			t.Errorf("WalkJSON(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestWalkXML(t *testing.T) {
+	values, ok := WalkXML([]byte(`<?xml version="1.0"?>
+<config env="prod">
+  <db><password>s3cret</password></db>
+  <key id="1">first</key>
+  <key id="2">second</key>
+</config>`))
+	if !ok {
+		t.Fatal("WalkXML failed")
+	}
+	want := map[string]string{
+		"/config/@env":        "env=prod",
+		"/config/db/password": "password=s3cret",
+		"/config/key/@id":     "id=1",
+		"/config/key":         "key=first",
+		"/config/key[2]/@id":  "id=2",
+		"/config/key[2]":      "key=second",
+	}
+	if got := structuredMap(values); !maps.Equal(got, want) {
+		t.Errorf("WalkXML = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{`plain text`, `<a><b>`, `<a>`} {
+		if _, ok := WalkXML([]byte(bad)); ok {
+			t.Errorf("WalkXML(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestWalkStructured(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		contentType string
+		want        bool
+	}{
+		{"json by content type", `"x"`, "application/json", true},
+		{"json by prefix", ` {"a":"b"}`, "text/plain", true},
+		{"xml by content type", `<a>b</a>`, "application/xml", true},
+		{"xml by prolog", `<?xml version="1.0"?><a>b</a>`, "", true},
+		{"html", `<html><body>x</body></html>`, "text/html", false},
+		{"javascript", `var a = 1;`, "application/javascript", false},
+		{"empty", "  ", "application/json", false},
+	}
+	for _, tt := range tests {
+		if _, ok := WalkStructured([]byte(tt.data), tt.contentType); ok != tt.want {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+}
+
+func TestMatchStructured(t *testing.T) {
+	rm := newAWSManager(t)
+	if err := rm.AddRule(Rule{Name: "password-field", KeyPattern: `(?i)^pass(word)?$`, Severity: SeverityMedium}); err != nil {
+		t.Fatal(err)
+	}
+	values, _ := WalkJSON([]byte(`{"db":{"password":"hunter2"},"note":"password","aws":"` + testAWSKey + `"}`))
+	got := make(map[string]string)
+	for _, m := range rm.MatchStructured(values) {
+		got[m.Rule] = m.Path + " " + m.Secret
+		if string(m.Source[m.Index:m.Index+m.Length]) != m.Value {
+			t.Errorf("%s: Index is not relative to Source", m.Rule)
+		}
+	}
+	want := map[string]string{
+		"password-field":    "/db/password hunter2",
+		"aws-access-key-id": "/aws " + testAWSKey,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("MatchStructured = %v, want %v", got, want)
+	}
+}
+
+func TestMergeStructured(t *testing.T) {
+	raw := []Match{{Rule: "aws-access-key-id", Value: testAWSKey, Secret: testAWSKey}}
+	structured := []Match{
+		{Rule: "aws-key-field", Value: testAWSKey, Secret: testAWSKey, Path: "/aws"},
+		{Rule: "password-field", Value: "hunter2", Secret: "hunter2", Path: "/db/password"},
+	}
+	merged := MergeStructured(raw, structured)
+	if len(merged) != 2 || merged[0].Rule != "aws-access-key-id" || merged[1].Rule != "password-field" {
+		t.Errorf("MergeStructured = %+v", merged)
+	}
+	if got := MergeStructured(nil, structured); len(got) != 2 {
+		t.Errorf("MergeStructured(nil) kept %d, want 2", len(got))
+	}
+}
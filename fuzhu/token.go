@@ -0,0 +1,337 @@
+package fuzhu
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 超过这个有效期的令牌视为长期令牌
+const LongLivedTokenThreshold = 30 * 24 * time.Hour
+
+// 令牌问题
+const (
+	TokenIssueAlgNone    = "alg-none"
+	TokenIssueExpired    = "expired"
+	TokenIssueNoExpiry   = "no-expiry"
+	TokenIssueLongLived  = "long-lived"
+	TokenIssueWeakSecret = "weak-secret"
+	TokenIssueUnsigned   = "unsigned"
+)
+
+//go:embed weak_jwt_secrets.txt
+var weakSecretList string
+
+var weakSecrets = func() []string {
+	var list []string
+	for _, line := range strings.Split(weakSecretList, "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			list = append(list, line)
+		}
+	}
+	return list
+}()
+
+// 本地解析出的令牌信息，不发起任何网络请求
+type TokenInfo struct {
+	Type       string                 `json:"type"` // jwt / saml
+	Header     map[string]interface{} `json:"header,omitempty"`
+	Claims     map[string]interface{} `json:"claims,omitempty"`
+	Alg        string                 `json:"alg,omitempty"`
+	Issuer     string                 `json:"iss,omitempty"`
+	Subject    string                 `json:"sub,omitempty"`
+	Audience   []string               `json:"aud,omitempty"`
+	Scopes     []string               `json:"scopes,omitempty"`
+	IssuedAt   *time.Time             `json:"iat,omitempty"`
+	NotBefore  *time.Time             `json:"nbf,omitempty"`
+	ExpiresAt  *time.Time             `json:"exp,omitempty"`
+	Issues     []string               `json:"issues,omitempty"`
+	WeakSecret string                 `json:"weak_secret,omitempty"`
+}
+
+// IntrospectToken 识别并解析 JWT 或 SAML 断言，不是令牌时返回 nil
+func IntrospectToken(value string, now time.Time) *TokenInfo {
+	if strings.HasPrefix(value, "eyJ") && strings.Count(value, ".") == 2 {
+		info, err := IntrospectJWT(value, now)
+		if err != nil {
+			return nil
+		}
+		return info
+	}
+	if info, err := IntrospectSAML(value, now); err == nil {
+		return info
+	}
+	return nil
+}
+
+func IntrospectJWT(token string, now time.Time) (*TokenInfo, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected 3 segments, got %d", len(parts))
+	}
+	info := &TokenInfo{Type: "jwt"}
+	if err := decodeJWTSegment(parts[0], &info.Header); err != nil {
+		return nil, err
+	}
+	if err := decodeJWTSegment(parts[1], &info.Claims); err != nil {
+		return nil, err
+	}
+
+	info.Alg, _ = info.Header["alg"].(string)
+	info.Issuer, _ = info.Claims["iss"].(string)
+	info.Subject, _ = info.Claims["sub"].(string)
+	info.Audience = stringList(info.Claims["aud"])
+	for _, key := range []string{"scope", "scp", "scopes", "roles", "permissions"} {
+		if v, ok := info.Claims[key]; ok {
+			info.Scopes = append(info.Scopes, stringList(v)...)
+		}
+	}
+	info.IssuedAt = unixClaim(info.Claims["iat"])
+	info.NotBefore = unixClaim(info.Claims["nbf"])
+	info.ExpiresAt = unixClaim(info.Claims["exp"])
+
+	if strings.EqualFold(info.Alg, "none") {
+		info.Issues = append(info.Issues, TokenIssueAlgNone)
+	}
+	info.checkLifetime(now)
+	if secret, ok := crackHMAC(info.Alg, parts); ok {
+		info.WeakSecret = secret
+		info.Issues = append(info.Issues, TokenIssueWeakSecret)
+	}
+	return info, nil
+}
+
+func (info *TokenInfo) checkLifetime(now time.Time) {
+	if info.ExpiresAt == nil {
+		info.Issues = append(info.Issues, TokenIssueNoExpiry)
+		return
+	}
+	if info.ExpiresAt.Before(now) {
+		info.Issues = append(info.Issues, TokenIssueExpired)
+	}
+	start := now
+	if info.IssuedAt != nil {
+		start = *info.IssuedAt
+	} else if info.NotBefore != nil {
+		start = *info.NotBefore
+	}
+	if info.ExpiresAt.Sub(start) > LongLivedTokenThreshold {
+		info.Issues = append(info.Issues, TokenIssueLongLived)
+	}
+}
+
+// 用弱密钥字典尝试验证 HS256/384/512 签名
+func crackHMAC(alg string, parts []string) (string, bool) {
+	var newHash func() hash.Hash
+	switch strings.ToUpper(alg) {
+	case "HS256":
+		newHash = sha256.New
+	case "HS384":
+		newHash = sha512.New384
+	case "HS512":
+		newHash = sha512.New
+	default:
+		return "", false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+	if err != nil || len(signature) == 0 {
+		return "", false
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+	for _, secret := range weakSecrets {
+		mac := hmac.New(newHash, []byte(secret))
+		mac.Write(signingInput)
+		if hmac.Equal(mac.Sum(nil), signature) {
+			return secret, true
+		}
+	}
+	return "", false
+}
+
+func stringList(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		// OAuth 的 scope 是空格分隔的字符串
+		return strings.Fields(t)
+	case []interface{}:
+		list := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func unixClaim(v interface{}) *time.Time {
+	f, ok := v.(float64)
+	if !ok {
+		return nil
+	}
+	t := time.Unix(int64(f), 0).UTC()
+	return &t
+}
+
+// SAML 断言中需要的字段
+type samlAssertion struct {
+	XMLName    xml.Name
+	Issuer     string `xml:"Issuer"`
+	Subject    string `xml:"Subject>NameID"`
+	Conditions struct {
+		NotBefore    string   `xml:"NotBefore,attr"`
+		NotOnOrAfter string   `xml:"NotOnOrAfter,attr"`
+		Audience     []string `xml:"AudienceRestriction>Audience"`
+	} `xml:"Conditions"`
+	IssueInstant string `xml:"IssueInstant,attr"`
+	Signature    *struct {
+		SignatureMethod struct {
+			Algorithm string `xml:"Algorithm,attr"`
+		} `xml:"SignedInfo>SignatureMethod"`
+	} `xml:"Signature"`
+	Attributes []struct {
+		Name   string   `xml:"Name,attr"`
+		Values []string `xml:"AttributeValue"`
+	} `xml:"AttributeStatement>Attribute"`
+}
+
+// 解压 HTTP-Redirect 绑定消息时最多读取的字节数
+const maxSAMLInflated = 1 << 20
+
+// IntrospectSAML 解析 SAML 断言，支持原始 XML、base64、URL 编码和 DEFLATE 压缩后的 SAMLResponse
+func IntrospectSAML(value string, now time.Time) (*TokenInfo, error) {
+	data := []byte(value)
+	if !bytes.Contains(data, []byte("Assertion")) {
+		// 只在确有百分号编码时解码，未编码的 base64 中的 + 不能变成空格
+		if strings.Contains(value, "%") {
+			if unescaped, err := url.PathUnescape(value); err == nil {
+				value = unescaped
+			}
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		data = decoded
+		// HTTP-Redirect 绑定的消息先经过 raw DEFLATE 压缩
+		if !bytes.Contains(data, []byte("Assertion")) {
+			if inflated, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(data)), maxSAMLInflated)); err == nil {
+				data = inflated
+			}
+		}
+	}
+	start := assertionStart(data)
+	if start == -1 {
+		return nil, fmt.Errorf("no SAML assertion found")
+	}
+
+	var a samlAssertion
+	if err := xml.NewDecoder(bytes.NewReader(data[start:])).Decode(&a); err != nil {
+		return nil, err
+	}
+	info := &TokenInfo{
+		Type:     "saml",
+		Issuer:   strings.TrimSpace(a.Issuer),
+		Subject:  strings.TrimSpace(a.Subject),
+		Audience: a.Conditions.Audience,
+	}
+	info.IssuedAt = samlTime(a.IssueInstant)
+	info.NotBefore = samlTime(a.Conditions.NotBefore)
+	info.ExpiresAt = samlTime(a.Conditions.NotOnOrAfter)
+	if a.Signature == nil {
+		info.Issues = append(info.Issues, TokenIssueUnsigned)
+	} else {
+		info.Alg = a.Signature.SignatureMethod.Algorithm
+	}
+	for _, attr := range a.Attributes {
+		if strings.Contains(strings.ToLower(attr.Name), "role") || strings.Contains(strings.ToLower(attr.Name), "group") {
+			info.Scopes = append(info.Scopes, attr.Values...)
+		}
+	}
+	info.checkLifetime(now)
+	return info, nil
+}
+
+// 找到 <Assertion 或 <xxx:Assertion 元素的起始位置
+func assertionStart(data []byte) int {
+	offset := 0
+	for {
+		i := bytes.Index(data[offset:], []byte("Assertion"))
+		if i == -1 {
+			return -1
+		}
+		i += offset
+		j := bytes.LastIndexByte(data[:i], '<')
+		if j != -1 && data[j+1] != '/' && !bytes.ContainsAny(data[j+1:i], " \t\r\n>") {
+			// 跳过 <samlp:Response> 外层，只取断言本身
+			end := i + len("Assertion")
+			if end < len(data) && (data[end] == ' ' || data[end] == '>' || data[end] == '\n' || data[end] == '\t') {
+				return j
+			}
+		}
+		offset = i + len("Assertion")
+	}
+}
+
+func samlTime(s string) *time.Time {
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// Redacted 返回按脱敏方式处理后的副本：破解出的签名密钥脱敏，头部和声明不保存，nil 返回 nil
+func (info *TokenInfo) Redacted(mode string) *TokenInfo {
+	if info == nil || mode == "" || mode == RedactNone {
+		return info
+	}
+	c := *info
+	c.Header, c.Claims = nil, nil
+	if c.WeakSecret != "" {
+		c.WeakSecret = RedactSecret(c.WeakSecret, mode)
+	}
+	return &c
+}
+
+// String 返回简短的摘要，用于日志
+func (info *TokenInfo) String() string {
+	var parts []string
+	if info.Alg != "" {
+		parts = append(parts, "alg="+info.Alg)
+	}
+	if info.Issuer != "" {
+		parts = append(parts, "iss="+info.Issuer)
+	}
+	if len(info.Audience) > 0 {
+		parts = append(parts, "aud="+strings.Join(info.Audience, ","))
+	}
+	if info.ExpiresAt != nil {
+		parts = append(parts, "exp="+info.ExpiresAt.Format(time.RFC3339))
+	}
+	if len(info.Scopes) > 0 {
+		parts = append(parts, "scopes="+strings.Join(info.Scopes, ","))
+	}
+	if len(info.Issues) > 0 {
+		parts = append(parts, "issues="+strings.Join(info.Issues, ","))
+	}
+	if info.WeakSecret != "" {
+		parts = append(parts, "secret="+info.WeakSecret)
+	}
+	return info.Type + " " + strings.Join(parts, " ")
+}
@@ -0,0 +1,152 @@
+package fuzhu
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var tokenNow = time.Date(2026, 1, 1, 0, 30, 0, 0, time.UTC)
+
+func signJWT(t *testing.T, header, claims map[string]interface{}, secret string) string {
+	t.Helper()
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := segment(header) + "." + segment(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestIntrospectJWT(t *testing.T) {
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	hour := map[string]interface{}{"iss": "https://idp.example", "sub": "alice", "aud": []string{"api", "web"}, "scope": "read write", "iat": tokenNow.Unix(), "exp": tokenNow.Add(time.Hour).Unix()}
+	tests := []struct {
+		name       string
+		token      string
+		issues     []string
+		weakSecret string
+	}{
+		{"strong secret", signJWT(t, hs256, hour, "kq3!Zr8#Lm2@Vx9$Tn4%"), nil, ""},
+		{"weak secret", signJWT(t, hs256, hour, "secretkey"), []string{TokenIssueWeakSecret}, "secretkey"},
+		{"no expiry", signJWT(t, hs256, map[string]interface{}{"sub": "alice"}, "kq3!Zr8#Lm2@Vx9$Tn4%"), []string{TokenIssueNoExpiry}, ""},
+		{"expired", signJWT(t, hs256, map[string]interface{}{"exp": tokenNow.Add(-time.Minute).Unix()}, "kq3!Zr8#Lm2@Vx9$Tn4%"), []string{TokenIssueExpired}, ""},
+		{"long lived", signJWT(t, hs256, map[string]interface{}{"iat": tokenNow.Unix(), "exp": tokenNow.Add(365 * 24 * time.Hour).Unix()}, "kq3!Zr8#Lm2@Vx9$Tn4%"), []string{TokenIssueLongLived}, ""},
+		{"alg none", signJWT(t, map[string]interface{}{"alg": "none"}, hour, "x"), []string{TokenIssueAlgNone}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := IntrospectJWT(tt.token, tokenNow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(info.Issues, tt.issues) {
+				t.Errorf("Issues = %v, want %v", info.Issues, tt.issues)
+			}
+			if info.WeakSecret != tt.weakSecret {
+				t.Errorf("WeakSecret = %q, want %q", info.WeakSecret, tt.weakSecret)
+			}
+		})
+	}
+
+	info, err := IntrospectJWT(tests[0].token, tokenNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Alg != "HS256" || info.Issuer != "https://idp.example" || info.Subject != "alice" ||
+		!slices.Equal(info.Audience, []string{"api", "web"}) || !slices.Equal(info.Scopes, []string{"read", "write"}) {
+		t.Errorf("claims not extracted: %+v", info)
+	}
+
+	for _, bad := range []string{"a.b", "eyJhbGciOiJIUzI1NiJ9.!!!.sig", "bm90anNvbg.e30.sig"} {
+		if _, err := IntrospectJWT(bad, tokenNow); err == nil {
+			t.Errorf("IntrospectJWT(%q) succeeded", bad)
+		}
+	}
+}
+
+const testAssertion = `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" IssueInstant="2026-01-01T00:00:00Z">` +
+	`<saml:Issuer>https://idp.example</saml:Issuer>` +
+	`<saml:Subject><saml:NameID>alice@corp.example</saml:NameID></saml:Subject>` +
+	`<saml:Conditions NotBefore="2026-01-01T00:00:00Z" NotOnOrAfter="2026-01-01T01:00:00Z">` +
+	`<saml:AudienceRestriction><saml:Audience>https://sp.example</saml:Audience></saml:AudienceRestriction></saml:Conditions>` +
+	`<saml:AttributeStatement><saml:Attribute Name="groups"><saml:AttributeValue>admins</saml:AttributeValue></saml:Attribute></saml:AttributeStatement>` +
+	`</saml:Assertion>`
+
+func TestIntrospectSAML(t *testing.T) {
+	response := `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol">` + testAssertion + `</samlp:Response>`
+	encoded := base64.StdEncoding.EncodeToString([]byte(response))
+	if !strings.Contains(encoded, "+") {
+		t.Fatal("test response should encode to base64 containing +")
+	}
+	var deflated bytes.Buffer
+	w, _ := flate.NewWriter(&deflated, flate.BestCompression)
+	w.Write([]byte(response))
+	w.Close()
+	redirect := base64.StdEncoding.EncodeToString(deflated.Bytes())
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"raw xml", testAssertion},
+		{"base64 with +", encoded},
+		{"url encoded", url.QueryEscape(encoded)},
+		{"deflate", redirect},
+		{"deflate url encoded", url.QueryEscape(redirect)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := IntrospectSAML(tt.value, tokenNow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Type != "saml" || info.Issuer != "https://idp.example" || info.Subject != "alice@corp.example" ||
+				!slices.Equal(info.Audience, []string{"https://sp.example"}) || !slices.Equal(info.Scopes, []string{"admins"}) {
+				t.Errorf("unexpected info: %+v", info)
+			}
+			if !slices.Equal(info.Issues, []string{TokenIssueUnsigned}) {
+				t.Errorf("Issues = %v, want [%s]", info.Issues, TokenIssueUnsigned)
+			}
+		})
+	}
+
+	if _, err := IntrospectSAML(base64.StdEncoding.EncodeToString([]byte("<html>no token</html>")), tokenNow); err == nil {
+		t.Error("IntrospectSAML succeeded without an assertion")
+	}
+}
+
+func TestTokenRedacted(t *testing.T) {
+	info, err := IntrospectJWT(signJWT(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"email": "admin@corp.example"}, "secretkey"), tokenNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Redacted(RedactNone) != info {
+		t.Error("RedactNone should return the same info")
+	}
+	for _, mode := range []string{RedactPartial, RedactFull} {
+		r := info.Redacted(mode)
+		if r.Claims != nil || r.Header != nil || r.WeakSecret == "secretkey" || r.WeakSecret == "" {
+			t.Errorf("%s: not redacted: %+v", mode, r)
+		}
+	}
+	if info.Claims == nil || info.WeakSecret != "secretkey" {
+		t.Error("Redacted modified the original")
+	}
+	if (*TokenInfo)(nil).Redacted(RedactFull) != nil {
+		t.Error("nil.Redacted should be nil")
+	}
+}
@@ -0,0 +1,221 @@
+package fuzhu
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 校验结果，记录在匹配结果和扫描结果上
+type ValidationResult struct {
+	Validator string `json:"validator"`
+	Passed    bool   `json:"passed"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// 匹配后的校验器，用于过滤占位符等误报
+type Validator interface {
+	Name() string
+	Validate(value string) ValidationResult
+}
+
+// 用函数实现的校验器
+type validatorFunc struct {
+	name string
+	fn   func(value string) (bool, string)
+}
+
+func (v validatorFunc) Name() string {
+	return v.name
+}
+
+func (v validatorFunc) Validate(value string) ValidationResult {
+	passed, detail := v.fn(value)
+	return ValidationResult{Validator: v.name, Passed: passed, Detail: detail}
+}
+
+func NewValidator(name string, fn func(value string) (bool, string)) Validator {
+	return validatorFunc{name: name, fn: fn}
+}
+
+// ShannonEntropy 计算每个字符的香农熵
+func ShannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	var entropy float64
+	for _, c := range counts {
+		p := float64(c) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// EntropyValidator 要求香农熵不低于 min
+func EntropyValidator(min float64) Validator {
+	return NewValidator(fmt.Sprintf("entropy>=%.1f", min), func(value string) (bool, string) {
+		e := ShannonEntropy(value)
+		return e >= min, fmt.Sprintf("%.2f", e)
+	})
+}
+
+// CharsetValidator 要求只包含 allowed 中的字符（为空表示不限制），且至少包含 minClasses 类字符
+// 字符类别为：小写字母、大写字母、数字、其他
+func CharsetValidator(allowed string, minClasses int) Validator {
+	return NewValidator(fmt.Sprintf("charset>=%d", minClasses), func(value string) (bool, string) {
+		var lower, upper, digit, other int
+		for _, r := range value {
+			if allowed != "" && !strings.ContainsRune(allowed, r) {
+				return false, fmt.Sprintf("invalid char %q", r)
+			}
+			switch {
+			case unicode.IsLower(r):
+				lower = 1
+			case unicode.IsUpper(r):
+				upper = 1
+			case unicode.IsDigit(r):
+				digit = 1
+			default:
+				other = 1
+			}
+		}
+		classes := lower + upper + digit + other
+		return classes >= minClasses, fmt.Sprintf("%d classes", classes)
+	})
+}
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func base62Encode(n uint32, width int) string {
+	buf := make([]byte, width)
+	for i := width - 1; i >= 0; i-- {
+		buf[i] = base62Alphabet[n%62]
+		n /= 62
+	}
+	return string(buf)
+}
+
+// CRC32Base62Validator 校验 前缀_30位随机+6位CRC32(base62) 格式的令牌，
+// GitHub (ghp_/gho_/ghu_/ghs_/ghr_) 和 npm (npm_) 令牌都使用这种格式
+func CRC32Base62Validator(name string) Validator {
+	return NewValidator(name, func(value string) (bool, string) {
+		i := strings.Index(value, "_")
+		if i == -1 || len(value)-i-1 != 36 {
+			return false, "unexpected length"
+		}
+		body := value[i+1:]
+		payload, checksum := body[:30], body[30:]
+		expected := base62Encode(crc32.ChecksumIEEE([]byte(payload)), 6)
+		if checksum != expected {
+			return false, "checksum mismatch"
+		}
+		return true, ""
+	})
+}
+
+func GitHubTokenValidator() Validator {
+	return CRC32Base62Validator("github-checksum")
+}
+
+func NPMTokenValidator() Validator {
+	return CRC32Base62Validator("npm-checksum")
+}
+
+// LuhnValidator 校验银行卡号的 Luhn 校验位，忽略空格和横线
+func LuhnValidator() Validator {
+	return NewValidator("luhn", func(value string) (bool, string) {
+		sum, n := 0, 0
+		for i := len(value) - 1; i >= 0; i-- {
+			c := value[i]
+			if c == ' ' || c == '-' {
+				continue
+			}
+			if c < '0' || c > '9' {
+				return false, "non-digit"
+			}
+			d := int(c - '0')
+			if n%2 == 1 {
+				d *= 2
+				if d > 9 {
+					d -= 9
+				}
+			}
+			sum += d
+			n++
+		}
+		if n < 12 {
+			return false, "too short"
+		}
+		return sum%10 == 0, ""
+	})
+}
+
+// JWTValidator 检查 JWT 结构：三段 base64url，头部和载荷为 JSON 对象且头部包含 alg
+func JWTValidator() Validator {
+	return NewValidator("jwt", func(value string) (bool, string) {
+		parts := strings.Split(value, ".")
+		if len(parts) != 3 {
+			return false, "expected 3 segments"
+		}
+		var header map[string]interface{}
+		if err := decodeJWTSegment(parts[0], &header); err != nil {
+			return false, "header: " + err.Error()
+		}
+		alg, _ := header["alg"].(string)
+		if alg == "" {
+			return false, "missing alg"
+		}
+		var claims map[string]interface{}
+		if err := decodeJWTSegment(parts[1], &claims); err != nil {
+			return false, "claims: " + err.Error()
+		}
+		return true, "alg=" + alg
+	})
+}
+
+// SAMLValidator 检查能否解析出 SAML 断言
+func SAMLValidator() Validator {
+	return NewValidator("saml", func(value string) (bool, string) {
+		info, err := IntrospectSAML(value, time.Now())
+		if err != nil {
+			return false, err.Error()
+		}
+		return true, "iss=" + info.Issuer
+	})
+}
+
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// RunValidators 依次执行校验器，全部通过才返回 true
+func RunValidators(validators []Validator, value string) ([]ValidationResult, bool) {
+	if len(validators) == 0 {
+		return nil, true
+	}
+	results := make([]ValidationResult, 0, len(validators))
+	passed := true
+	for _, v := range validators {
+		r := v.Validate(value)
+		results = append(results, r)
+		if !r.Passed {
+			passed = false
+		}
+	}
+	return results, passed
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+)
+
+var (
+	harvestStore       *fuzhu.HarvestStore
+	errHarvestDisabled = errors.New("harvest store is disabled")
+	// 当前项目名称，收集结果按项目分别汇总
+	engagement = "default"
+)
+
+// 请求体只收集开头部分，避免上传大文件时拖慢代理
+const maxHarvestRequestBody = 256 << 10
+
+// 被动收集扫描队列中响应体里的子域名、内网地址、存储桶和邮箱，请求和响应头由 harvestExchange 收集
+func harvestResponse(data ResponseData) {
+	harvestData(data.URL, data.Host, data.Body)
+}
+
+// 收集请求头、请求体和响应头，在代理中对所有状态码的响应调用，跳过扫描的响应也会收集
+func harvestExchange(rawURL, host string, reqHeader, respHeader http.Header, reqBody []byte) {
+	if harvestStore == nil {
+		return
+	}
+	var buf bytes.Buffer
+	for _, h := range []http.Header{reqHeader, respHeader} {
+		for k, vs := range h {
+			for _, v := range vs {
+				fmt.Fprintf(&buf, "%s: %s\n", k, v)
+			}
+		}
+	}
+	if len(reqBody) > maxHarvestRequestBody {
+		reqBody = reqBody[:maxHarvestRequestBody]
+	}
+	buf.Write(reqBody)
+	harvestData(rawURL, host, buf.Bytes())
+}
+
+func harvestData(rawURL, host string, data []byte) {
+	if harvestStore == nil || len(data) == 0 {
+		return
+	}
+	for _, item := range harvestStore.Add(engagement, rawURL, fuzhu.Harvest(data, harvestScope(host))) {
+		logger.Infof("[harvest] %s %s <- %s", item.Kind, item.Value, rawURL)
+	}
+}
+
+// 范围内的主域名：启用范围限制时为包含列表中的主域名，否则为当前页面的主域名
+func harvestScope(pageHost string) func(string) bool {
+	domains := make(map[string]bool)
+	if cfg := scopeManager.Config(); cfg.Enabled && len(cfg.Include) > 0 {
+		for _, d := range cfg.Include {
+			domains[extractMainDomain(d)] = true
+		}
+	} else {
+		domains[extractMainDomain(pageHost)] = true
+	}
+	return func(host string) bool {
+		return domains[extractMainDomain(host)] && !scopeManager.Excluded(host)
+	}
+}
+
+// GET /api/harvest?engagement=&kind=&q=&offset=&limit=
+func handleHarvestList(w http.ResponseWriter, r *http.Request) {
+	list, err := harvestList(r)
+	if err != nil {
+		writeError(w, harvestErrorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, paginate(r, list))
+}
+
+// GET /api/harvest/export?engagement=&kind=&format=txt|csv|json
+func handleHarvestExport(w http.ResponseWriter, r *http.Request) {
+	list, err := harvestList(r)
+	if err != nil {
+		writeError(w, harvestErrorStatus(err), err)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "", "txt":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, item := range list {
+			fmt.Fprintln(w, item.Value)
+		}
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"kind", "value", "first_seen", "first_url", "hits"})
+		for _, item := range list {
+			cw.Write([]string{item.Kind, item.Value, item.FirstSeen.Format(time.RFC3339), item.FirstURL, fmt.Sprint(item.Hits)})
+		}
+		cw.Flush()
+	case "json":
+		writeJSON(w, http.StatusOK, list)
+	default:
+		writeError(w, http.StatusBadRequest, errors.New("format 只能是 txt、csv 或 json"))
+	}
+}
+
+func harvestErrorStatus(err error) int {
+	if errors.Is(err, errHarvestDisabled) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+func harvestList(r *http.Request) ([]fuzhu.HarvestItem, error) {
+	if harvestStore == nil {
+		return nil, errHarvestDisabled
+	}
+	query := r.URL.Query()
+	name := query.Get("engagement")
+	if name == "" {
+		name = engagement
+	}
+	kind := query.Get("kind")
+	if kind != "" && !slices.Contains(fuzhu.HarvestKinds, kind) {
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+	list := harvestStore.List(name, kind)
+	if q := query.Get("q"); q != "" {
+		filtered := list[:0]
+		for _, item := range list {
+			if strings.Contains(item.Value, q) {
+				filtered = append(filtered, item)
+			}
+		}
+		list = filtered
+	}
+	return list, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopr/fuzhu"
+
+	"github.com/elazarl/goproxy"
+)
+
+var historyStore *fuzhu.HistoryStore
+
+// 历史记录和收集最多保存的请求体大小，超出部分直接转发，不读进内存
+const maxRequestBodyCapture = 1 << 20
+
+// 请求到响应之间保存在 ctx.UserData 中的数据
+type exchangeContext struct {
+	start     time.Time
+	reqBody   []byte
+	truncated bool // 请求体超过 maxRequestBodyCapture，只保存了开头
+}
+
+// 记录请求开始时间和请求体的开头，用于历史记录和收集
+func beginExchange(req *http.Request, ctx *goproxy.ProxyCtx) {
+	if historyStore == nil && harvestStore == nil {
+		return
+	}
+	body, complete := readPrefix(&req.Body, maxRequestBodyCapture)
+	ctx.UserData = &exchangeContext{
+		start:     time.Now(),
+		reqBody:   body,
+		truncated: !complete,
+	}
+}
+
+// 保存一次完整的请求/响应，返回历史记录ID，未启用时返回0
+func recordExchange(resp *http.Response, ctx *goproxy.ProxyCtx, body []byte) int64 {
+	if historyStore == nil {
+		return 0
+	}
+	ex := &fuzhu.Exchange{
+		Time:           time.Now(),
+		Method:         ctx.Req.Method,
+		URL:            ctx.Req.URL.String(),
+		Host:           ctx.Req.URL.Host,
+		RequestHeader:  ctx.Req.Header.Clone(),
+		StatusCode:     resp.StatusCode,
+		ResponseHeader: resp.Header.Clone(),
+		ResponseBody:   body,
+	}
+	if ec, ok := ctx.UserData.(*exchangeContext); ok {
+		ex.Time = ec.start
+		ex.RequestBody = ec.reqBody
+		ex.RequestBodyTruncated = ec.truncated
+		ex.Duration = time.Since(ec.start)
+	}
+	return historyStore.Add(ex)
+}
+
+// GET /api/history?host=&method=&status=&q=&after=&offset=&limit=
+// after 只返回ID大于该值的记录，用于轮询新流量
+func handleHistoryList(w http.ResponseWriter, r *http.Request) {
+	if historyStore == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("history is disabled"))
+		return
+	}
+	query := r.URL.Query()
+	host, method, q := query.Get("host"), query.Get("method"), query.Get("q")
+	status, _ := strconv.Atoi(query.Get("status"))
+	after, _ := strconv.ParseInt(query.Get("after"), 10, 64)
+	var list []fuzhu.ExchangeSummary
+	for _, s := range historyStore.Summaries() {
+		if s.ID <= after {
+			continue
+		}
+		if host != "" && !strings.Contains(s.Host, host) {
+			continue
+		}
+		if method != "" && !strings.EqualFold(s.Method, method) {
+			continue
+		}
+		if status != 0 && s.StatusCode != status {
+			continue
+		}
+		if q != "" && !strings.Contains(s.URL, q) {
+			continue
+		}
+		list = append(list, s)
+	}
+	writeJSON(w, http.StatusOK, paginate(r, list))
+}
+
+func handleHistoryGet(w http.ResponseWriter, r *http.Request) {
+	if historyStore == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("history is disabled"))
+		return
+	}
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ex, err := historyStore.Get(id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, fuzhu.ErrExchangeNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ex)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+
+	"github.com/elazarl/goproxy"
+)
+
+var interceptManager *fuzhu.InterceptManager
+
+// 挂起请求，等待放行、编辑或丢弃
+func interceptRequest(req *http.Request, filter fuzhu.InterceptFilter) (*http.Request, *http.Response) {
+	body := readAndRestoreBody(&req.Body)
+	item := &fuzhu.InterceptItem{
+		Phase:  fuzhu.InterceptPhaseRequest,
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+		Body:   body,
+	}
+	d := interceptManager.Hold(item, filter.Timeout)
+	if d.Action == fuzhu.InterceptActionDrop {
+		logger.Infof("[intercept] #%d 已丢弃请求 %s %s", item.ID, item.Method, item.URL)
+		return req, goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusBadGateway, "dropped by intercept")
+	}
+
+	if d.Method != "" {
+		req.Method = d.Method
+	}
+	if d.URL != "" {
+		u, err := url.Parse(d.URL)
+		if err != nil {
+			logger.Errorf("[intercept] #%d 编辑后的URL无效: %v", item.ID, err)
+		} else {
+			req.URL = u
+			req.Host = u.Host
+		}
+	}
+	if d.Header != nil {
+		req.Header = d.Header
+	}
+	if d.Body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(d.Body))
+		req.ContentLength = int64(len(d.Body))
+		req.Header.Set("Content-Length", strconv.Itoa(len(d.Body)))
+	}
+	return req, nil
+}
+
+// 挂起响应，等待放行、编辑或丢弃
+func interceptResponse(resp *http.Response, ctx *goproxy.ProxyCtx, filter fuzhu.InterceptFilter) *http.Response {
+	body := readAndRestoreBody(&resp.Body)
+	item := &fuzhu.InterceptItem{
+		Phase:      fuzhu.InterceptPhaseResponse,
+		Method:     ctx.Req.Method,
+		URL:        ctx.Req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+	}
+	d := interceptManager.Hold(item, filter.Timeout)
+	if d.Action == fuzhu.InterceptActionDrop {
+		logger.Infof("[intercept] #%d 已丢弃响应 %s %s", item.ID, item.Method, item.URL)
+		return goproxy.NewResponse(ctx.Req, goproxy.ContentTypeText, http.StatusBadGateway, "dropped by intercept")
+	}
+
+	if d.StatusCode != 0 {
+		resp.StatusCode = d.StatusCode
+		resp.Status = strconv.Itoa(d.StatusCode) + " " + http.StatusText(d.StatusCode)
+	}
+	if d.Header != nil {
+		resp.Header = d.Header
+	}
+	if d.Body != nil {
+		resp.Body = io.NopCloser(bytes.NewReader(d.Body))
+		resp.ContentLength = int64(len(d.Body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(d.Body)))
+	}
+	return resp
+}
+
+// 读取并重新设置 body，便于后续继续读取
+func readAndRestoreBody(body *io.ReadCloser) []byte {
+	if *body == nil {
+		return nil
+	}
+	data, _ := io.ReadAll(*body)
+	(*body).Close()
+	*body = io.NopCloser(bytes.NewBuffer(data))
+	return data
+}
+
+// 把挂起项写成便于在编辑器中修改的文本：首行为 "方法 URL" 或状态码，接着是头部、空行和正文
+func formatInterceptItem(item *fuzhu.InterceptItem) []byte {
+	var buf bytes.Buffer
+	if item.Phase == fuzhu.InterceptPhaseResponse {
+		fmt.Fprintf(&buf, "%d\n", item.StatusCode)
+	} else {
+		fmt.Fprintf(&buf, "%s %s\n", item.Method, item.URL)
+	}
+	item.Header.Write(&buf)
+	buf.WriteString("\n")
+	buf.Write(item.Body)
+	return buf.Bytes()
+}
+
+// 解析编辑后的文本，格式同 formatInterceptItem
+func parseInterceptEdit(item *fuzhu.InterceptItem, data []byte) (fuzhu.InterceptDecision, error) {
+	d := fuzhu.InterceptDecision{Action: fuzhu.InterceptActionForward}
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(data)))
+	first, err := r.ReadLine()
+	if err != nil {
+		return d, err
+	}
+	if item.Phase == fuzhu.InterceptPhaseResponse {
+		if d.StatusCode, err = strconv.Atoi(strings.TrimSpace(first)); err != nil {
+			return d, fmt.Errorf("invalid status line %q", first)
+		}
+	} else {
+		method, rawURL, ok := strings.Cut(strings.TrimSpace(first), " ")
+		if !ok {
+			return d, fmt.Errorf("invalid request line %q", first)
+		}
+		d.Method, d.URL = method, strings.TrimSpace(rawURL)
+	}
+	header, err := r.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return d, err
+	}
+	d.Header = http.Header(header)
+	if d.Header == nil {
+		d.Header = make(http.Header)
+	}
+	if d.Body, err = io.ReadAll(r.R); err != nil {
+		return d, err
+	}
+	// 编辑器会在文件末尾补换行，原正文没有时去掉
+	if !bytes.HasSuffix(item.Body, []byte("\n")) {
+		d.Body = bytes.TrimSuffix(d.Body, []byte("\n"))
+	}
+	return d, nil
+}
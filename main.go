@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -19,90 +20,174 @@ import (
 	"github.com/elazarl/goproxy"
 )
 
-var regexManager = fuzhu.NewRegexManager()
+var (
+	regexManager = fuzhu.NewRegexManager()
+	proxyServer  *goproxy.ProxyHttpServer
+	findingStore *fuzhu.FindingStore
+	caCert       []byte
+	// 扫描结果上下文和脱敏选项
+	contextOptions = fuzhu.DefaultContextOptions
+	// 扫描前递归解码的层数
+	decodeDepth = fuzhu.DefaultDecodeDepth
+)
+
+// 子命令提前退出前写完异步日志，os.Exit 不会执行 main 中的 defer
+func exitCommand(code int) {
+	logger.Flush()
+	os.Exit(code)
+}
 
 func main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		// 文件日志是异步写入的，子命令返回前写完
+		defer logger.Flush()
+		switch os.Args[1] {
+		case "replay":
+			runReplayCommand(os.Args[2:])
+			return
+		case "endpoints":
+			runEndpointsCommand(os.Args[2:])
+			return
+		case "rules":
+			runRulesCommand(os.Args[2:])
+			return
+		case "notify":
+			runNotifyCommand(os.Args[2:])
+			return
+		}
+	}
 
 	// 添加命令行参数支持
 	upstreamProxyFlag := flag.String("p", "", "上游代理地址 (例如: http://proxy:port)")
 	verboseFlag := flag.Bool("v", false, "详细信息")
+	adminFlag := flag.String("admin", "127.0.0.1:8890", "本地控制接口监听地址，为空则不启用")
+	interceptFlag := flag.Bool("intercept", false, "启动时开启拦截模式")
+	interceptURLFlag := flag.String("intercept-url", "", "拦截的URL正则，为空表示全部")
+	interceptPhaseFlag := flag.String("intercept-phase", "", "拦截阶段 (request/response)，为空表示两者")
+	interceptTimeoutFlag := flag.Duration("intercept-timeout", 60*time.Second, "拦截项超时后自动放行")
+	historyFlag := flag.String("history", "history", "历史记录目录，为空则不保存")
+	historyMaxFlag := flag.Int("history-max", 100000, "最多保留的历史记录条数，超出时删除最早的，0为不限")
+	historyMaxAgeFlag := flag.Duration("history-max-age", 0, "历史记录的保留时间，例如 168h，0为不限")
+	findingsFlag := flag.String("findings", "findings.jsonl", "扫描结果存储文件，启动时从中加载，结果更新时追加整条记录（同一 id 以最后一条为准），不轮转；外部工具请读取 -findings-log，为空则不保存")
+	adminTokenFlag := flag.String("admin-token", "", "控制接口令牌，为空时随机生成")
+	scopeFlag := flag.String("scope", "", "只扫描这些域名及其子域名，逗号分隔")
+	tuiFlag := flag.Bool("tui", false, "使用交互式终端界面代替滚动日志")
+	contextBeforeFlag := flag.Int("context-before", fuzhu.DefaultContextOptions.Before, "扫描结果保留匹配前的字节数")
+	contextAfterFlag := flag.Int("context-after", fuzhu.DefaultContextOptions.After, "扫描结果保留匹配后的字节数")
+	decodeDepthFlag := flag.Int("decode-depth", fuzhu.DefaultDecodeDepth, "扫描前递归解码 base64/URL/hex/转义/HTML实体 的层数，0为不解码")
+	sourceMapDirFlag := flag.String("sourcemap-dir", "", "保存从 source map 还原的源文件的目录，为空则不保存")
+	harvestFlag := flag.String("harvest", "harvest.jsonl", "被动收集的子域名、内网地址、存储桶和邮箱保存文件，为空则不收集")
+	engagementFlag := flag.String("engagement", "default", "项目名称，收集结果按项目汇总")
+	queueSizeFlag := flag.Int("queue-size", cap(responseQueue), "内存扫描队列的容量")
+	queueMemoryFlag := flag.Int64("queue-memory", queueMemoryLimit>>20, "内存扫描队列中响应体总大小的上限 (MB)")
+	spoolFlag := flag.String("spool", "", "内存扫描队列满时写入的溢出目录，为空则直接丢弃")
+	spoolSizeFlag := flag.Int64("spool-size", 1024, "溢出目录的大小上限 (MB)")
+	spoolPolicyFlag := flag.String("spool-policy", fuzhu.SpoolDropOldest, "溢出目录满时的丢弃策略 (oldest/newest/lowest-priority)")
+	shutdownTimeoutFlag := flag.Duration("shutdown-timeout", shutdownTimeout, "退出时等待在途请求完成的最长时间")
+	drainTimeoutFlag := flag.Duration("drain-timeout", drainTimeout, "退出时等待扫描队列清空的最长时间")
+	redactFlag := flag.String("redact", fuzhu.RedactNone, "日志、上下文和历史记录的认证头部中密钥的脱敏方式 (none/partial/full)")
+	notifyFlag := flag.String("notify", "", "通知配置文件，新的高危扫描结果推送到其中的 webhook，为空则不通知")
+	archiveFlag := flag.String("archive", "", "响应内容归档目录，为空则不归档")
+	archiveTypesFlag := flag.String("archive-types", strings.Join(fuzhu.ArchiveKinds, ","), "归档的内容类别，逗号分隔 (image/js/json/pdf/archive)")
+	archiveMaxSizeFlag := flag.Int64("archive-max-size", 50, "单个归档响应的大小上限 (MB)")
+	metadataFlag := flag.Bool("metadata", false, "从图片、PDF 和 Office 文档中提取元数据并扫描，开启后这些响应体 (每个最多 32MB) 会被完整读入内存并进入扫描队列")
+	logConfigFlag := flag.String("log-config", "", "日志配置文件 (JSON)，命令行上的日志参数优先")
+	applyLogFlags := logFlags()
 	flag.Parse()
 
+	if err := setupLogger(*logConfigFlag, applyLogFlags); err != nil {
+		logger.Fatal("日志配置有误:", err)
+	}
+	contextOptions = fuzhu.ContextOptions{Before: *contextBeforeFlag, After: *contextAfterFlag, Redact: *redactFlag}
+	decodeDepth = *decodeDepthFlag
+	metadataEnabled = *metadataFlag
+	shutdownTimeout = *shutdownTimeoutFlag
+	drainTimeout = *drainTimeoutFlag
+	sourceMapDir = *sourceMapDirFlag
+	responseQueue = make(chan ResponseData, *queueSizeFlag)
+	queueMemoryLimit = *queueMemoryFlag << 20
+	if *spoolFlag != "" {
+		if err := setupSpool(*spoolFlag, *spoolSizeFlag<<20, *spoolPolicyFlag); err != nil {
+			logger.Fatal("打开溢出目录失败:", err)
+		}
+	}
 	go processResponseLogs()
-	// +++初始化正则表达式管理器+++
+	loadPatterns()
 
-	for _, pattern := range fuzhu.SecretPatterns {
-		if err := regexManager.AddPattern(pattern); err != nil {
-			logger.Errorf("添加正则表达式失败: %v", err)
+	if *historyFlag != "" {
+		store, err := fuzhu.NewHistoryStore(*historyFlag)
+		if err != nil {
+			logger.Fatal("打开历史记录失败:", err)
 		}
+		store.SetRedact(contextOptions.Redact)
+		store.SetRetention(*historyMaxFlag, *historyMaxAgeFlag)
+		historyStore = store
+		logger.Infof("历史记录保存在 %s，已有 %d 条", *historyFlag, store.Count())
 	}
-	// ---初始化正则表达式管理器---
-
-	proxyServer := goproxy.NewProxyHttpServer()
-	proxyServer.Verbose = *verboseFlag
-
-	// 根据命令行参数配置上游代理
-	if *upstreamProxyFlag != "" {
-		upstreamProxy, err := url.Parse(*upstreamProxyFlag)
+	if *findingsFlag != "" {
+		store, err := fuzhu.NewFindingStore(*findingsFlag)
 		if err != nil {
-			logger.Fatal("解析上游代理地址失败:", err)
+			logger.Fatal("打开扫描结果文件失败:", err)
+		}
+		findingStore = store
+		go syncFindingsLoop()
+	}
+	if *harvestFlag != "" {
+		store, err := fuzhu.NewHarvestStore(*harvestFlag)
+		if err != nil {
+			logger.Fatal("打开收集结果文件失败:", err)
+		}
+		harvestStore = store
+		engagement = *engagementFlag
+	}
+	if *archiveFlag != "" {
+		if err := setupArchiver(*archiveFlag, *archiveTypesFlag, *archiveMaxSizeFlag<<20); err != nil {
+			logger.Fatal("打开归档目录失败:", err)
+		}
+	}
+	if *notifyFlag != "" {
+		if err := setupNotifier(*notifyFlag, *redactFlag); err != nil {
+			logger.Fatal("读取通知配置失败:", err)
 		}
+	}
+	if *scopeFlag != "" {
+		for _, domain := range strings.Split(*scopeFlag, ",") {
+			scopeManager.Include(domain)
+		}
+		scopeManager.SetEnabled(true)
+	}
 
-		proxyServer.Tr = &http.Transport{
-			Proxy: http.ProxyURL(upstreamProxy),
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			// DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			// 	// 对于 HTTP 代理，我们需要直接使用 net.Dialer
-			// 	dialer := &net.Dialer{
-			// 		Timeout:   30 * time.Second,
-			// 		KeepAlive: 30 * time.Second,
-			// 	}
+	interceptManager = fuzhu.NewInterceptManager(*interceptTimeoutFlag)
+	if *interceptURLFlag != "" || *interceptPhaseFlag != "" {
+		filter := fuzhu.InterceptFilter{Phase: *interceptPhaseFlag}
+		if *interceptURLFlag != "" {
+			re, err := regexp.Compile(*interceptURLFlag)
+			if err != nil {
+				logger.Fatal("解析拦截URL正则失败:", err)
+			}
+			filter.URLPattern = re
+		}
+		interceptManager.AddFilter(filter)
+	}
+	interceptManager.SetEnabled(*interceptFlag)
 
-			// 	if upstreamProxy.Scheme == "http" || upstreamProxy.Scheme == "https" {
-			// 		return dialer.DialContext(ctx, network, addr)
-			// 	}
+	proxyServer = goproxy.NewProxyHttpServer()
+	proxyServer.Verbose = *verboseFlag
+	proxyServer.Logger = metricsProxyLogger{next: proxyServer.Logger}
 
-			// 	// 对于 SOCKS 代理
-			// 	proxyDialer, err := proxy.FromURL(upstreamProxy, dialer)
-			// 	if err != nil {
-			// 		return nil, err
-			// 	}
-			// 	return proxyDialer.Dial(network, addr)
-			// },
-			// 添加以下优化配置
-			MaxIdleConns:        1000,             // 最大空闲连接数
-			MaxIdleConnsPerHost: 100,              // 每个主机的最大空闲连接数
-			MaxConnsPerHost:     100,              // 每个主机的最大连接数
-			IdleConnTimeout:     90 * time.Second, // 空闲连接超时时间
-			DisableKeepAlives:   false,            // 启用 keep-alive
-		}
+	// 根据命令行参数配置上游代理
+	tr, err := newTransport(*upstreamProxyFlag)
+	if err != nil {
+		logger.Fatal("解析上游代理地址失败:", err)
+	}
+	proxyServer.Tr = tr
+	if *upstreamProxyFlag != "" {
 		logger.Infof("已启用上游代理: %s", *upstreamProxyFlag)
-	} else {
-		// 即使不使用上游代理，也优化本地代理的传输设置
-		proxyServer.Tr = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			MaxIdleConns:        1000,
-			MaxIdleConnsPerHost: 100,
-			MaxConnsPerHost:     100,
-			IdleConnTimeout:     90 * time.Second,
-			DisableKeepAlives:   false,
-		}
 	}
 
 	// 加载自定义证书
-	caCert, err := os.ReadFile("ca.crt")
+	caCert, err = os.ReadFile("ca.crt")
 	if err != nil {
 		logger.Fatal("读取CA证书失败:", err)
 	}
@@ -122,6 +207,10 @@ func main() {
 	goproxy.GoproxyCa = ca
 	proxyServer.OnRequest().HandleConnect(goproxy.AlwaysMitm)
 
+	if *adminFlag != "" {
+		startAdminServer(*adminFlag, *adminTokenFlag)
+	}
+
 	// 监听所有请求
 	proxyServer.OnRequest().DoFunc(func(req *http.Request, ctx *goproxy.ProxyCtx) (*http.Request, *http.Response) {
 		// if req.Header.Get("Upgrade") == "websocket" {
@@ -134,46 +223,104 @@ func main() {
 		// 	}
 		// }
 		// logger.Printf("[请求] %s %s\n", req.Method, req.URL)
+		if shuttingDown.Load() {
+			return req, rejectDuringShutdown(req)
+		}
+		beginInFlight(ctx)
+		stats.Requests.Add(1)
+		requestsTotal.WithLabelValues(req.Method).Inc()
+		if req.ContentLength > 0 {
+			transferBytes.WithLabelValues("request").Add(float64(req.ContentLength))
+		}
+		if filter, ok := interceptManager.Match(fuzhu.InterceptPhaseRequest, req.Method, req.URL.String(), ""); ok {
+			var resp *http.Response
+			if req, resp = interceptRequest(req, filter); resp != nil {
+				return req, resp
+			}
+		}
+		beginExchange(req, ctx)
+		ctx.RoundTripper = goproxy.RoundTripperFunc(timedRoundTripper)
 		return req, nil
 	})
 
 	// 监听所有响应
 	proxyServer.OnResponse().DoFunc(func(resp *http.Response, ctx *goproxy.ProxyCtx) *http.Response {
+		defer endInFlight(ctx)
 		if resp == nil || ctx == nil || ctx.Req == nil {
 			return resp
 		}
-		domain := extractMainDomain(ctx.Req.URL.Host)
-		if shouldSkipHost(domain) {
-			// logger.Debugf("skip host: %s", domain)
+		stats.Responses.Add(1)
+		responsesTotal.WithLabelValues(statusClass(resp.StatusCode)).Inc()
+		if filter, ok := interceptManager.Match(fuzhu.InterceptPhaseResponse, ctx.Req.Method, ctx.Req.URL.String(), resp.Header.Get("Content-Type")); ok {
+			resp = interceptResponse(resp, ctx, filter)
+		}
+		if shouldSkipHost(ctx.Req.URL.Host) {
+			// logger.Debugf("skip host: %s", ctx.Req.URL.Host)
 			return resp
 		}
 
+		var reqBody []byte
+		if ec, ok := ctx.UserData.(*exchangeContext); ok {
+			reqBody = ec.reqBody
+		}
+		harvestExchange(ctx.Req.URL.String(), ctx.Req.URL.Host, ctx.Req.Header, resp.Header, reqBody)
+
 		contentType := resp.Header.Get("Content-Type")
-		if shouldSkipContentType(contentType) {
-			return resp
+		sniffed := sniffResponse(resp)
+		skip := shouldSkipContent(contentType, sniffed)
+		var limit int64
+		if skip {
+			limit = skippedBodyLimit(resp, ctx.Req.URL.String(), sniffed)
 		}
-		if resp.StatusCode != 200 {
+		if skip && limit == 0 {
+			// 图片、视频等只记录请求和响应头，不读取响应体
+			if resp.ContentLength > 0 {
+				transferBytes.WithLabelValues("response").Add(float64(resp.ContentLength))
+			}
+			checkContentMismatch(resp, ctx, recordExchange(resp, ctx, nil), sniffed)
 			return resp
 		}
 		// 读取响应体
 		var body []byte
-		if resp.Body != nil {
+		if resp.Body != nil && skip {
+			// 只为归档或提取元数据读取，超过上限的不再缓存，剩余部分直接转发
+			var complete bool
+			if body, complete = readBodyLimited(resp, limit); !complete {
+				if resp.ContentLength > 0 {
+					transferBytes.WithLabelValues("response").Add(float64(resp.ContentLength))
+				}
+				checkContentMismatch(resp, ctx, recordExchange(resp, ctx, nil), sniffed)
+				return resp
+			}
+			transferBytes.WithLabelValues("response").Add(float64(len(body)))
+		} else if resp.Body != nil {
 			body, _ = io.ReadAll(resp.Body)
 			// 重新设置响应体
 			resp.Body = io.NopCloser(bytes.NewBuffer(body))
+			transferBytes.WithLabelValues("response").Add(float64(len(body)))
 		}
-		// 将数据发送到队列
-		select {
-		case responseQueue <- ResponseData{
-			Method:     ctx.Req.Method,
-			URL:        ctx.Req.URL.String(),
-			StatusCode: resp.StatusCode,
-			Body:       body,
-		}:
-		default:
-			// 如果队列满了，记录一个警告但不阻塞
-			logger.Warn("Response queue is full, skipping log")
+		// 只为归档或提取元数据读取的图片等内容，历史记录中仍不保存响应体
+		historyBody := body
+		if skip {
+			historyBody = nil
+		}
+		exchangeID := recordExchange(resp, ctx, historyBody)
+		checkContentMismatch(resp, ctx, exchangeID, sniffed)
+		if resp.StatusCode != 200 {
+			return resp
 		}
+		// 将数据发送到队列
+		enqueueResponse(ResponseData{
+			ExchangeID:    exchangeID,
+			Method:        ctx.Req.Method,
+			URL:           ctx.Req.URL.String(),
+			Host:          ctx.Req.URL.Host,
+			StatusCode:    resp.StatusCode,
+			ContentType:   contentType,
+			Header:        resp.Header.Clone(),
+			Body:          body,
+			RequestHeader: ctx.Req.Header.Clone(),
+		})
 		// if false {
 		// 	if resp != nil {
 		// 		body, err := io.ReadAll(resp.Body)
@@ -187,53 +334,181 @@ func main() {
 		// 		}
 		// 	}
 		// }
-		// if false {
-		// 	if resp != nil {
-		// 		// 读取响应体
-		// 		body, err := io.ReadAll(resp.Body)
-		// 		if err == nil {
-		// 			// 检查是否为图片
-		// 			if fuzhu.IsImageResponse(resp) {
-		// 				if err := fuzhu.SaveImage(body, resp.Request.URL.String()); err == nil {
-		// 					logger.Printf("已保存图片: %s\n", resp.Request.URL)
-		// 				}
-		// 			}
-		// 			// 重新设置响应体
-		// 			resp.Body = io.NopCloser(bytes.NewBuffer(body))
-		// 		}
-		// 	}
-		// }
 		return resp
 	})
 
+	if *tuiFlag {
+		startTUI()
+	}
+
+	fuzhu.SetShutdownHandler(gracefulShutdown)
+	proxyHTTPServer = &http.Server{Addr: ":8889", Handler: proxyServer}
 	logger.Print("启动代理服务器在 :8889...")
-	logger.Fatal(http.ListenAndServe(":8889", proxyServer))
+	if err := proxyHTTPServer.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Fatal(err)
+	}
+	// 关闭流程结束后由信号处理退出进程
+	select {}
+}
+
+// 创建代理使用的 transport，upstream 为空时直连
+func newTransport(upstream string) (*http.Transport, error) {
+	if upstream != "" {
+		upstreamProxy, err := url.Parse(upstream)
+		if err != nil {
+			return nil, err
+		}
+
+		return &http.Transport{
+			Proxy: http.ProxyURL(upstreamProxy),
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			// DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			// 	// 对于 HTTP 代理，我们需要直接使用 net.Dialer
+			// 	dialer := &net.Dialer{
+			// 		Timeout:   30 * time.Second,
+			// 		KeepAlive: 30 * time.Second,
+			// 	}
+
+			// 	if upstreamProxy.Scheme == "http" || upstreamProxy.Scheme == "https" {
+			// 		return dialer.DialContext(ctx, network, addr)
+			// 	}
+
+			// 	// 对于 SOCKS 代理
+			// 	proxyDialer, err := proxy.FromURL(upstreamProxy, dialer)
+			// 	if err != nil {
+			// 		return nil, err
+			// 	}
+			// 	return proxyDialer.Dial(network, addr)
+			// },
+			// 添加以下优化配置
+			MaxIdleConns:        1000,             // 最大空闲连接数
+			MaxIdleConnsPerHost: 100,              // 每个主机的最大空闲连接数
+			MaxConnsPerHost:     100,              // 每个主机的最大连接数
+			IdleConnTimeout:     90 * time.Second, // 空闲连接超时时间
+			DisableKeepAlives:   false,            // 启用 keep-alive
+		}, nil
+	}
+	// 即使不使用上游代理，也优化本地代理的传输设置
+	return &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        1000,
+		MaxIdleConnsPerHost: 100,
+		MaxConnsPerHost:     100,
+		IdleConnTimeout:     90 * time.Second,
+		DisableKeepAlives:   false,
+	}, nil
 }
 
 type ResponseData struct {
-	Method     string
-	URL        string
-	StatusCode int
-	Body       []byte
+	ExchangeID    int64
+	Method        string
+	URL           string
+	Host          string
+	StatusCode    int
+	ContentType   string
+	Header        http.Header
+	RequestHeader http.Header
+	Body          []byte
+	SourceFile    string // 从 source map 还原的源文件路径
+
+	spooled  bool  // 从溢出目录取出，扫描完后删除
+	spoolSeq int64 // 在溢出目录中的序号
+}
+
+// 初始化正则表达式管理器
+func loadPatterns() {
+	for _, rule := range builtinRules() {
+		if err := regexManager.AddRule(rule); err != nil {
+			logger.Errorf("添加规则 %s 失败: %v", rule.Name, err)
+		}
+	}
 }
 
-var responseQueue = make(chan ResponseData, 100000)
+// 内置的所有规则，SecretPatterns 中的正则以自身为名称
+func builtinRules() []fuzhu.Rule {
+	rules := make([]fuzhu.Rule, 0, len(fuzhu.SecretPatterns)+len(fuzhu.SecretRules))
+	for _, pattern := range fuzhu.SecretPatterns {
+		rules = append(rules, fuzhu.Rule{Name: pattern, Pattern: pattern})
+	}
+	return append(rules, fuzhu.SecretRules...)
+}
 
 func processResponseLogs() {
 	for data := range responseQueue {
-		matches := regexManager.MatchAll(data.Body)
-		if len(matches) > 0 {
-			for i := 0; i < len(matches); i++ {
-				m := matches[i]
-				if strings.Contains(m.GroupValues[0], `"same-origin"`) {
-					continue
-				}
-				logger.Infof("[res] %s %s -> %v", data.Method, data.URL, m.GroupValues[0])
-			}
-		}
+		dequeueResponse(data)
+		processResponse(data)
+		finishResponse(data)
+		stats.Scanned.Add(1)
+		scannedTotal.Inc()
+		scanPending.Add(-1)
 		// logger.Printf("[res] %s %s -> [%d] %d", data.Method, data.URL, data.StatusCode, bodylength)
 	}
 }
+
+// 归档、提取元数据、扫描、收集和整理端点，代理和重放的响应都经过这里
+func processResponse(data ResponseData) {
+	archiveResponse(data)
+	sniffed := fuzhu.SniffContent(data.Body)
+	extractResponseMetadata(data, sniffed)
+	// 只为归档或提取元数据读取的图片等内容不扫描
+	if shouldSkipContent(data.ContentType, sniffed) {
+		return
+	}
+	// source map 的源文件已按原文件扫描过，不再扫描整个 JSON
+	if !checkSourceMap(data) {
+		scanResponse(data)
+	}
+	harvestResponse(data)
+	if n := collectEndpoints(endpointInventory, data.URL, data.ContentType, data.Body); n > 0 {
+		logger.Debugf("[endpoints] %s 新增 %d 个端点", data.URL, n)
+	}
+}
+
+// 用规则扫描响应体或还原出的源文件
+func scanResponse(data ResponseData) {
+	where := data.URL
+	if data.SourceFile != "" {
+		where += " [" + data.SourceFile + "]"
+	}
+	matches := regexManager.MatchDecoded(data.Body, decodeDepth)
+	// JSON/XML 按键名和值扫描，原始内容中已找到的值不再重复报告
+	if values, ok := fuzhu.WalkStructured(data.Body, data.ContentType); ok {
+		matches = fuzhu.MergeStructured(matches, regexManager.MatchStructured(values))
+	}
+	for i := 0; i < len(matches); i++ {
+		m := matches[i]
+		if strings.Contains(m.GroupValues[0], `"same-origin"`) {
+			continue
+		}
+		ctx := fuzhu.ExtractContext(m.Source, m, contextOptions)
+		log := logger.With("exchange", data.ExchangeID, "url", data.URL, "rule", m.Rule, "severity", m.Severity)
+		switch {
+		case ctx == nil:
+			log.Infof("[res] %s %s -> %s", data.Method, where, fuzhu.RedactSecret(m.GroupValues[0], contextOptions.Redact))
+		case m.Path != "":
+			log.Infof("[res] %s %s %s -> %s", data.Method, where, m.Path, ctx.Value)
+		case m.Decoding != "":
+			log.Infof("[res] %s %s [%s] -> %s", data.Method, where, m.Decoding, ctx.Value)
+			log.Debugf("[res] %s", ctx.Snippet())
+		default:
+			log.Infof("[res] %s %s:%s -> %s", data.Method, where, ctx.Location(), ctx.Value)
+			log.Debugf("[res] %s", ctx.Snippet())
+		}
+		saveFinding(data, m, ctx)
+	}
+}
 func shouldSkipContentType(contentType string) bool {
 	skipTypes := []string{
 		"image/",
@@ -252,33 +527,36 @@ func shouldSkipContentType(contentType string) bool {
 	}
 	return false
 }
+
+// 默认跳过的域名
+var defaultSkipHosts = []string{
+	"google.com",
+	"gstatic.com",
+	"googleapis.com",
+	"github.com",
+	"cloudflare.com",
+	"gravatar.com",
+	"youtube.com",
+	"ytimg.com",
+	"facebook.com",
+	"fbcdn.net",
+	"twitter.com",
+	"twimg.com",
+	"microsoft.com",
+	"msn.com",
+	"live.com",
+	"akamai.net",
+	"jsdelivr.net",
+	"unpkg.com",
+	"baidu.com",
+	"csdn.net",
+	"cnblogs.com",
+}
+
+var scopeManager = fuzhu.NewScopeManager(defaultSkipHosts)
+
 func shouldSkipHost(host string) bool {
-	skipHosts := map[string]bool{
-		"google.com":     true,
-		"gstatic.com":    true,
-		"googleapis.com": true,
-		"github.com":     true,
-		"cloudflare.com": true,
-		"gravatar.com":   true,
-		"youtube.com":    true,
-		"ytimg.com":      true,
-		"facebook.com":   true,
-		"fbcdn.net":      true,
-		"twitter.com":    true,
-		"twimg.com":      true,
-		"microsoft.com":  true,
-		"msn.com":        true,
-		"live.com":       true,
-		"akamai.net":     true,
-		"jsdelivr.net":   true,
-		"unpkg.com":      true,
-		"baidu.com":      true,
-		"csdn.net":       true,
-		"cnblogs.com":    true,
-	}
-
-	mainDomain := extractMainDomain(host)
-	return skipHosts[mainDomain]
+	return !scopeManager.InScope(host)
 }
 func extractMainDomain(host string) string {
 	// 移除端口号
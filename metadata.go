@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+)
+
+// 是否从图片和文档中提取元数据，由 -metadata 设置
+var metadataEnabled = false
+
+// 响应是否需要为提取元数据读取响应体，长度未知的按 MetadataMaxSize 限量读取
+func wantsMetadata(resp *http.Response, sniffed fuzhu.ContentClass) bool {
+	return metadataEnabled && resp.StatusCode == http.StatusOK && fuzhu.HasMetadata(sniffed) &&
+		resp.ContentLength != 0 && resp.ContentLength <= fuzhu.MetadataMaxSize
+}
+
+// 提取图片和文档的元数据，保存到历史记录，并用规则扫描和收集其中的信息
+func extractResponseMetadata(data ResponseData, sniffed fuzhu.ContentClass) {
+	if !metadataEnabled {
+		return
+	}
+	fields := fuzhu.ExtractMetadata(data.Body, sniffed)
+	if len(fields) == 0 {
+		return
+	}
+	logger.With("exchange", data.ExchangeID, "url", data.URL).Debugf("[metadata] %s 提取到 %d 项元数据", data.URL, len(fields))
+	if historyStore != nil && data.ExchangeID != 0 {
+		if err := historyStore.SetMetadata(data.ExchangeID, fields); err != nil {
+			logger.Warnf("[metadata] 保存 #%d 的元数据失败: %v", data.ExchangeID, err)
+		}
+	}
+
+	for _, m := range regexManager.MatchStructured(fuzhu.MetadataValues(fields)) {
+		ctx := fuzhu.ExtractContext(m.Source, m, contextOptions)
+		log := logger.With("exchange", data.ExchangeID, "url", data.URL, "rule", m.Rule, "severity", m.Severity)
+		if ctx != nil {
+			log.Infof("[metadata] %s %s -> %s", data.URL, m.Path, ctx.Value)
+		} else {
+			log.Infof("[metadata] %s %s -> %s", data.URL, m.Path, fuzhu.RedactSecret(m.GroupValues[0], contextOptions.Redact))
+		}
+		saveFinding(data, m, ctx)
+	}
+
+	var text bytes.Buffer
+	for _, f := range fields {
+		// 照片中的 GPS 坐标会暴露拍摄地点
+		if f.Name == "GPSPosition" {
+			logger.With("exchange", data.ExchangeID, "url", data.URL).Infof("[metadata] %s GPS -> %s", data.URL, f.Value)
+			saveFinding(data, fuzhu.Match{
+				Rule:        "metadata-gps",
+				Severity:    fuzhu.SeverityMedium,
+				Value:       f.Value,
+				GroupValues: []string{f.Value},
+				Path:        "/" + f.Source + "/" + f.Name,
+			}, nil)
+		}
+		fmt.Fprintf(&text, "%s: %s\n", f.Name, f.Value)
+	}
+	if harvestStore != nil {
+		for _, item := range harvestStore.Add(engagement, data.URL, fuzhu.Harvest(text.Bytes(), harvestScope(data.Host))) {
+			logger.Infof("[harvest] %s %s <- %s (metadata)", item.Kind, item.Value, data.URL)
+		}
+	}
+}
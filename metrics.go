@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+
+	"github.com/elazarl/goproxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus 指标，在控制接口的 /metrics 上提供
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gopr_requests_total",
+		Help: "经过代理的请求数",
+	}, []string{"method"})
+	responsesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gopr_responses_total",
+		Help: "经过代理的响应数，按状态码类别",
+	}, []string{"code"})
+	transferBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gopr_bytes_total",
+		Help: "经过代理的请求体和响应体字节数",
+	}, []string{"direction"})
+	upstreamLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gopr_upstream_latency_seconds",
+		Help:    "从发出请求到收到上游响应头的耗时",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"code"})
+	queueDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gopr_response_queue_dropped_total",
+		Help: "扫描队列已满而丢弃的响应数，按丢弃原因",
+	}, []string{"reason"})
+	scannedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gopr_scanned_total",
+		Help: "已扫描的响应数",
+	})
+	tlsHandshakeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gopr_tls_handshake_failures_total",
+		Help: "TLS 握手失败次数，client 为与客户端的中间人握手，upstream 为与上游的握手",
+	}, []string{"side"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal, responsesTotal, transferBytes, upstreamLatency,
+		queueDropped, scannedTotal, tlsHandshakeFailures,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gopr_response_queue_depth",
+			Help: "扫描队列中等待的响应数",
+		}, func() float64 { return float64(len(responseQueue)) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gopr_response_queue_capacity",
+			Help: "扫描队列容量",
+		}, func() float64 { return float64(cap(responseQueue)) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gopr_response_queue_bytes",
+			Help: "扫描队列中响应体的总大小",
+		}, func() float64 { return float64(queuedBytes.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gopr_spool_items",
+			Help: "溢出目录中等待扫描的响应数",
+		}, func() float64 { return float64(spoolStats().Items) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gopr_spool_bytes",
+			Help: "溢出目录的大小",
+		}, func() float64 { return float64(spoolStats().Bytes) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "gopr_log_dropped_total",
+			Help: "日志写入队列已满而丢弃的应用日志条数，扫描结果日志不丢弃",
+		}, func() float64 { return float64(logger.Dropped()) }),
+		scanCollector{},
+	)
+}
+
+// 采集时从规则统计和扫描结果中读取的指标
+type scanCollector struct{}
+
+var (
+	ruleScanSecondsDesc = prometheus.NewDesc("gopr_rule_scan_seconds_total", "规则累计执行耗时", []string{"id", "rule"}, nil)
+	ruleScanCallsDesc   = prometheus.NewDesc("gopr_rule_scan_calls_total", "规则执行次数", []string{"id", "rule"}, nil)
+	ruleScanMaxDesc     = prometheus.NewDesc("gopr_rule_scan_max_seconds", "规则单次执行的最长耗时", []string{"id", "rule"}, nil)
+	ruleDemotedDesc     = prometheus.NewDesc("gopr_rule_demoted", "规则是否因超出耗时预算被降级", []string{"id", "rule"}, nil)
+	findingsDesc        = prometheus.NewDesc("gopr_findings", "扫描结果数量，不含误报", []string{"severity"}, nil)
+)
+
+func (scanCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ruleScanSecondsDesc
+	ch <- ruleScanCallsDesc
+	ch <- ruleScanMaxDesc
+	ch <- ruleDemotedDesc
+	ch <- findingsDesc
+}
+
+func (scanCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, p := range regexManager.Profile() {
+		id := strconv.Itoa(p.ID)
+		ch <- prometheus.MustNewConstMetric(ruleScanSecondsDesc, prometheus.CounterValue, p.Total.Seconds(), id, p.Name)
+		ch <- prometheus.MustNewConstMetric(ruleScanCallsDesc, prometheus.CounterValue, float64(p.Calls), id, p.Name)
+		ch <- prometheus.MustNewConstMetric(ruleScanMaxDesc, prometheus.GaugeValue, p.Max.Seconds(), id, p.Name)
+		demoted := 0.0
+		if p.Demoted {
+			demoted = 1
+		}
+		ch <- prometheus.MustNewConstMetric(ruleDemotedDesc, prometheus.GaugeValue, demoted, id, p.Name)
+	}
+	if findingStore == nil {
+		return
+	}
+	counts := make(map[string]int)
+	for _, f := range findingStore.List() {
+		if !f.FalsePositive {
+			counts[f.Severity]++
+		}
+	}
+	for _, severity := range fuzhu.Severities {
+		ch <- prometheus.MustNewConstMetric(findingsDesc, prometheus.GaugeValue, float64(counts[severity]), severity)
+	}
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// 状态码类别，例如 2xx
+func statusClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+// 记录上游耗时和上游 TLS 握手失败的 RoundTripper
+func timedRoundTripper(req *http.Request, ctx *goproxy.ProxyCtx) (*http.Response, error) {
+	start := time.Now()
+	resp, err := ctx.Proxy.Tr.RoundTrip(req)
+	if err != nil {
+		// 中间人连接上出错时 goproxy 不再调用响应处理
+		endInFlight(ctx)
+		upstreamLatency.WithLabelValues("error").Observe(time.Since(start).Seconds())
+		if isTLSError(err) {
+			tlsHandshakeFailures.WithLabelValues("upstream").Inc()
+		}
+		return nil, err
+	}
+	upstreamLatency.WithLabelValues(statusClass(resp.StatusCode)).Observe(time.Since(start).Seconds())
+	return resp, nil
+}
+
+func isTLSError(err error) bool {
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var alertErr tls.AlertError
+	return errors.As(err, &recordErr) || errors.As(err, &certErr) || errors.As(err, &alertErr) ||
+		strings.Contains(err.Error(), "tls: ")
+}
+
+// goproxy 只通过日志报告与客户端的握手失败，这里包装它的日志来计数
+type metricsProxyLogger struct {
+	next goproxy.Logger
+}
+
+func (l metricsProxyLogger) Printf(format string, v ...any) {
+	if strings.Contains(format, "Cannot handshake client") {
+		tlsHandshakeFailures.WithLabelValues("client").Inc()
+	}
+	l.next.Printf(format, v...)
+}
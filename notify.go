@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+)
+
+// 新扫描结果的通知器，为 nil 时不通知
+var notifier *fuzhu.Notifier
+
+// 按配置文件创建通知器，脱敏方式未配置时沿用 -redact
+func setupNotifier(path, redact string) error {
+	config, err := fuzhu.LoadNotifyConfig(path)
+	if err != nil {
+		return err
+	}
+	if config.Redact == "" {
+		config.Redact = redact
+	}
+	n, err := fuzhu.NewNotifier(*config)
+	if err != nil {
+		return err
+	}
+	notifier = n
+	logger.Infof("已配置 %d 个通知目标，阈值 %s", len(config.Webhooks), config.MinSeverity)
+	return nil
+}
+
+// gopr notify <test|mock> [选项]
+func runNotifyCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "用法: gopr notify <test|mock> [选项]")
+		exitCommand(2)
+	}
+	switch args[0] {
+	case "test":
+		runNotifyTest(args[1:])
+	case "mock":
+		runNotifyMock(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, "未知的子命令:", args[0])
+		exitCommand(2)
+	}
+}
+
+// 向配置的所有目标发送一条示例扫描结果
+func runNotifyTest(args []string) {
+	fs := flag.NewFlagSet("notify test", flag.ExitOnError)
+	configFlag := fs.String("config", "notify.json", "通知配置文件")
+	fs.Parse(args)
+
+	if err := setupNotifier(*configFlag, ""); err != nil {
+		logger.Fatal("读取通知配置失败:", err)
+	}
+	f := &fuzhu.Finding{
+		Time:     time.Now(),
+		Method:   http.MethodGet,
+		URL:      "https://example.com/static/app.js",
+		Host:     "example.com",
+		Rule:     "gopr-notify-test",
+		Severity: fuzhu.SeverityCritical,
+		Value:    "this-is-a-test-notification",
+	}
+	if err := notifier.Send(f); err != nil {
+		logger.Fatal("发送失败:", err)
+	}
+	fmt.Println("已发送测试通知")
+}
+
+// 启动本地模拟接收端，打印收到的消息
+func runNotifyMock(args []string) {
+	fs := flag.NewFlagSet("notify mock", flag.ExitOnError)
+	listenFlag := fs.String("listen", "127.0.0.1:9300", "监听地址")
+	failFlag := fs.Int("fail", 0, "前几次请求返回 500，用于测试重试")
+	fs.Parse(args)
+
+	mock := &fuzhu.MockReceiver{
+		FailFirst: *failFlag,
+		OnReceive: func(m fuzhu.MockMessage) {
+			fmt.Printf("[%s] POST %s\n%s\n\n", m.Time.Format("15:04:05"), m.Path, m.Body)
+		},
+	}
+	logger.Infof("模拟接收端监听 http://%s/", *listenFlag)
+	if err := http.ListenAndServe(*listenFlag, mock); err != nil {
+		logger.Fatal("启动模拟接收端失败:", err)
+	}
+}
+
+// GET /api/notify
+func handleNotifyStats(w http.ResponseWriter, r *http.Request) {
+	if notifier == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("notifier is disabled"))
+		return
+	}
+	writeJSON(w, http.StatusOK, notifier.Stats())
+}
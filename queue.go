@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+)
+
+// 未启用溢出目录时的丢弃原因，其他丢弃原因见溢出目录的丢弃策略
+const (
+	dropQueueFull   = "queue-full"   // 内存队列已满
+	dropMemoryLimit = "memory-limit" // 响应体总大小超过 -queue-memory
+)
+
+var (
+	responseQueue = make(chan ResponseData, 100000)
+	// 内存队列中响应体的总大小上限，超过后写入溢出目录
+	queueMemoryLimit int64 = 1 << 30
+	queuedBytes      atomic.Int64
+	// 磁盘溢出队列，为 nil 时内存队列满了直接丢弃
+	spool *fuzhu.Spool
+)
+
+// 打开溢出目录并开始把其中的响应送回扫描队列
+func setupSpool(dir string, maxBytes int64, policy string) error {
+	s, err := fuzhu.OpenSpool(dir, maxBytes, policy)
+	if err != nil {
+		return err
+	}
+	spool = s
+	if n := s.Len(); n > 0 {
+		scanPending.Add(int64(n))
+		logger.Infof("溢出目录 %s 中有 %d 个未扫描的响应", dir, n)
+	}
+	go feedFromSpool()
+	return nil
+}
+
+// 放入扫描队列，内存队列满或超过内存上限时写入溢出目录
+func enqueueResponse(data ResponseData) {
+	scanPending.Add(1)
+	size := int64(len(data.Body))
+	reason := dropQueueFull
+	// 溢出目录中还有数据时新数据也写入溢出目录，保持先后顺序
+	if spool == nil || spool.Len() == 0 {
+		if queuedBytes.Load()+size > queueMemoryLimit {
+			reason = dropMemoryLimit
+		} else {
+			select {
+			case responseQueue <- data:
+				queuedBytes.Add(size)
+				return
+			default:
+			}
+		}
+	}
+	if spool == nil {
+		dropResponses(reason, 1)
+		return
+	}
+	buf, err := json.Marshal(data)
+	if err != nil {
+		dropResponses(fuzhu.SpoolDropError, 1)
+		return
+	}
+	dropped, reason, err := spool.Push(buf, fuzhu.ContentPriority(data.ContentType, data.URL))
+	if err != nil {
+		logger.Errorf("写入溢出目录失败: %v", err)
+	}
+	if dropped > 0 {
+		dropResponses(reason, dropped)
+	}
+}
+
+// 从内存队列取出后调用
+func dequeueResponse(data ResponseData) {
+	queuedBytes.Add(-int64(len(data.Body)))
+}
+
+// 扫描完后调用，来自溢出目录的响应这时才删除
+func finishResponse(data ResponseData) {
+	if data.spooled && spool != nil {
+		spool.Done(data.spoolSeq)
+	}
+}
+
+// 扫描队列中还没有扫描完的响应数，不包括留在溢出目录中的
+func memoryPending() int64 {
+	n := scanPending.Load()
+	if spool != nil {
+		n -= int64(spool.Len())
+	}
+	return n
+}
+
+// 按写入顺序把溢出目录中的响应送回内存队列，内存队列满时等待，扫描完后才从目录中删除
+func feedFromSpool() {
+	for {
+		buf, seq, err := spool.Pop()
+		if err == fuzhu.ErrSpoolClosed {
+			return
+		}
+		var data ResponseData
+		if err == nil {
+			if err = json.Unmarshal(buf, &data); err != nil {
+				spool.Done(seq)
+			}
+		}
+		if err != nil {
+			logger.Errorf("读取溢出目录失败: %v", err)
+			dropResponses(fuzhu.SpoolDropError, 1)
+			continue
+		}
+		data.spooled, data.spoolSeq = true, seq
+		size := int64(len(data.Body))
+		for queuedBytes.Load() > 0 && queuedBytes.Load()+size > queueMemoryLimit {
+			time.Sleep(50 * time.Millisecond)
+		}
+		responseQueue <- data
+		queuedBytes.Add(size)
+	}
+}
+
+// 溢出目录的统计，未启用时为零值
+func spoolStats() fuzhu.SpoolStats {
+	if spool == nil {
+		return fuzhu.SpoolStats{}
+	}
+	return spool.Stats()
+}
+
+func dropResponses(reason string, n int) {
+	scanPending.Add(-int64(n))
+	stats.QueueDropped.Add(int64(n))
+	queueDropped.WithLabelValues(reason).Add(float64(n))
+	logger.Warnf("扫描队列已满，丢弃 %d 个响应 (%s)", n, reason)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+)
+
+// 可重复的 -H 参数
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("请求头格式应为 'Name: value': %s", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// gopr replay [选项] <id>
+func runReplayCommand(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	upstreamProxyFlag := fs.String("p", "", "上游代理地址 (例如: http://proxy:port)")
+	historyFlag := fs.String("history", "history", "历史记录目录")
+	methodFlag := fs.String("method", "", "替换请求方法")
+	urlFlag := fs.String("url", "", "替换完整URL")
+	targetFlag := fs.String("target", "", "替换目标 scheme://host[:port]")
+	bodyFlag := fs.String("body", "", "替换请求体")
+	bodyFileFlag := fs.String("body-file", "", "从文件读取替换的请求体")
+	findingsFlag := fs.String("findings", "", "重放响应的扫描结果保存文件，为空则只输出")
+	harvestFlag := fs.String("harvest", "", "重放响应的收集结果保存文件，为空则不收集")
+	engagementFlag := fs.String("engagement", "default", "项目名称，收集结果按项目汇总")
+	var headers headerFlags
+	fs.Var(&headers, "H", "覆盖请求头，可重复 (例如: -H 'Authorization: Bearer x')")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: gopr replay [选项] <id>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exitCommand(2)
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		logger.Fatal("无效的历史记录ID:", fs.Arg(0))
+	}
+
+	store, err := fuzhu.OpenHistoryStore(*historyFlag)
+	if err != nil {
+		logger.Fatal("打开历史记录失败:", err)
+	}
+	orig, err := store.Get(id)
+	if err != nil {
+		logger.Fatalf("读取历史记录 #%d 失败: %v", id, err)
+	}
+
+	opts := fuzhu.ReplayOptions{Method: *methodFlag, URL: *urlFlag, Target: *targetFlag}
+	if len(headers) > 0 {
+		opts.Header = make(http.Header)
+		for _, h := range headers {
+			name, value, _ := strings.Cut(h, ":")
+			opts.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+	if *bodyFileFlag != "" {
+		body, err := os.ReadFile(*bodyFileFlag)
+		if err != nil {
+			logger.Fatal("读取请求体文件失败:", err)
+		}
+		opts.Body = &body
+	} else if *bodyFlag != "" {
+		body := []byte(*bodyFlag)
+		opts.Body = &body
+	}
+
+	tr, err := newTransport(*upstreamProxyFlag)
+	if err != nil {
+		logger.Fatal("解析上游代理地址失败:", err)
+	}
+	loadPatterns()
+	replayed, err := fuzhu.Replay(tr, orig, opts)
+	if err != nil {
+		logger.Fatalf("重放 #%d 失败: %v", id, err)
+	}
+	printReplayDiff(replayed, fuzhu.DiffExchanges(orig, replayed, regexManager))
+
+	if *findingsFlag != "" {
+		if findingStore, err = fuzhu.NewFindingStore(*findingsFlag); err != nil {
+			logger.Fatal("打开扫描结果文件失败:", err)
+		}
+		defer findingStore.Sync()
+	}
+	if *harvestFlag != "" {
+		if harvestStore, err = fuzhu.NewHarvestStore(*harvestFlag); err != nil {
+			logger.Fatal("打开收集结果文件失败:", err)
+		}
+		engagement = *engagementFlag
+		defer harvestStore.Sync()
+	}
+	harvestExchange(replayed.URL, replayed.Host, replayed.RequestHeader, replayed.ResponseHeader, replayed.RequestBody)
+	if replayed.StatusCode == http.StatusOK {
+		processResponse(replayResponseData(replayed))
+	}
+}
+
+// 重放的响应按代理中的响应扫描
+func replayResponseData(ex *fuzhu.Exchange) ResponseData {
+	return ResponseData{
+		ExchangeID:    ex.ID,
+		Method:        ex.Method,
+		URL:           ex.URL,
+		Host:          ex.Host,
+		StatusCode:    ex.StatusCode,
+		ContentType:   ex.ResponseHeader.Get("Content-Type"),
+		Header:        ex.ResponseHeader,
+		Body:          ex.ResponseBody,
+		RequestHeader: ex.RequestHeader,
+	}
+}
+
+func printReplayDiff(replayed *fuzhu.Exchange, diff fuzhu.ExchangeDiff) {
+	fmt.Printf("%s %s\n", replayed.Method, replayed.URL)
+	fmt.Printf("状态码: %d -> %d\n", diff.OriginalStatus, diff.ReplayStatus)
+	fmt.Printf("长度:   %d -> %d\n", diff.OriginalLength, diff.ReplayLength)
+	fmt.Printf("耗时:   %s\n", replayed.Duration)
+	if len(diff.HeaderChanges) > 0 {
+		fmt.Println("响应头变化:")
+		for _, c := range diff.HeaderChanges {
+			fmt.Println("  " + c)
+		}
+	}
+	if diff.BodyIdentical {
+		fmt.Println("响应体: 相同")
+	} else {
+		fmt.Println("响应体变化:")
+		for _, c := range diff.BodyChanges {
+			fmt.Println("  " + c)
+		}
+	}
+	for _, m := range diff.NewMatches {
+		fmt.Println("新增匹配: " + m)
+	}
+	for _, m := range diff.GoneMatches {
+		fmt.Println("消失匹配: " + m)
+	}
+}
+
+// POST /api/history/{id}/replay，请求体为 ReplayOptions，可为空
+func handleReplay(w http.ResponseWriter, r *http.Request) {
+	if historyStore == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("history is disabled"))
+		return
+	}
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	orig, err := historyStore.Get(id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, fuzhu.ErrExchangeNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+	var opts fuzhu.ReplayOptions
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	replayed, err := fuzhu.Replay(proxyServer.Tr, orig, opts)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, fuzhu.ErrRequestBodyTruncated) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err)
+		return
+	}
+	historyStore.Add(replayed)
+	logger.Infof("[replay] #%d -> #%d %s %s [%d]", orig.ID, replayed.ID, replayed.Method, replayed.URL, replayed.StatusCode)
+	if !shouldSkipHost(replayed.Host) {
+		harvestExchange(replayed.URL, replayed.Host, replayed.RequestHeader, replayed.ResponseHeader, replayed.RequestBody)
+		if replayed.StatusCode == http.StatusOK {
+			enqueueResponse(replayResponseData(replayed))
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":   replayed.ID,
+		"diff": fuzhu.DiffExchanges(orig, replayed, regexManager),
+	})
+}
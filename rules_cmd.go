@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+
+	"github.com/pterm/pterm"
+)
+
+// gopr rules <子命令> [选项]
+func runRulesCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "用法: gopr rules <profile|test> [选项]")
+		exitCommand(2)
+	}
+	switch args[0] {
+	case "profile":
+		runRulesProfile(args[1:])
+	case "test":
+		runRulesTest(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, "未知的子命令:", args[0])
+		exitCommand(2)
+	}
+}
+
+// 用历史记录中的响应体执行所有规则，输出最慢的规则
+func runRulesProfile(args []string) {
+	fs := flag.NewFlagSet("rules profile", flag.ExitOnError)
+	historyFlag := fs.String("history", "history", "历史记录目录")
+	topFlag := fs.Int("top", 20, "显示耗时最多的规则数量，0为全部")
+	decodeDepthFlag := fs.Int("decode-depth", fuzhu.DefaultDecodeDepth, "扫描前递归解码的层数，与代理保持一致")
+	fs.Parse(args)
+
+	store, err := fuzhu.OpenHistoryStore(*historyFlag)
+	if err != nil {
+		logger.Fatal("打开历史记录失败:", err)
+	}
+	loadPatterns()
+
+	start := time.Now()
+	var bodies, size int
+	for _, s := range store.Summaries() {
+		ex, err := store.Get(s.ID)
+		if err != nil || len(ex.ResponseBody) == 0 {
+			continue
+		}
+		bodies++
+		size += len(ex.ResponseBody)
+		regexManager.MatchDecoded(ex.ResponseBody, *decodeDepthFlag)
+		if values, ok := fuzhu.WalkStructured(ex.ResponseBody, ex.ResponseHeader.Get("Content-Type")); ok {
+			regexManager.MatchStructured(values)
+		}
+	}
+	fmt.Printf("扫描了 %d 个响应体，共 %d 字节，用时 %s\n\n", bodies, size, time.Since(start).Round(time.Millisecond))
+
+	list := regexManager.Profile()
+	if *topFlag > 0 && len(list) > *topFlag {
+		list = list[:*topFlag]
+	}
+	data := pterm.TableData{{"#", "规则", "调用", "总耗时", "平均", "最长", "字节", "超限跳过", "超出预算", "降级"}}
+	for _, p := range list {
+		demoted := ""
+		if p.Demoted {
+			demoted = "是"
+		}
+		data = append(data, []string{
+			fmt.Sprint(p.ID), truncate(p.Name, 40), fmt.Sprint(p.Calls),
+			p.Total.Round(time.Microsecond).String(), p.Avg.Round(time.Microsecond).String(), p.Max.Round(time.Microsecond).String(),
+			fmt.Sprint(p.Bytes), fmt.Sprint(p.Skipped), fmt.Sprint(p.OverBudget), demoted,
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
+
+// 用规则自带的样例和语料目录检查所有内置规则，存在错误时以状态码 1 退出
+func runRulesTest(args []string) {
+	fs := flag.NewFlagSet("rules test", flag.ExitOnError)
+	corpusFlag := fs.String("corpus", "", "语料目录，其中 "+fuzhu.NegativeCorpusDir+" 目录下的文件不应被任何规则命中")
+	formatFlag := fs.String("format", "text", "输出格式：text、json")
+	fs.Parse(args)
+
+	var corpus []fuzhu.CorpusFile
+	if *corpusFlag != "" {
+		var err error
+		if corpus, err = fuzhu.LoadCorpus(*corpusFlag); err != nil {
+			logger.Fatal("读取语料失败:", err)
+		}
+	}
+	report := fuzhu.TestRules(builtinRules(), corpus)
+
+	if *formatFlag == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printRuleTestReport(report)
+	}
+	if report.Failed() {
+		exitCommand(1)
+	}
+}
+
+func printRuleTestReport(report *fuzhu.RuleTestReport) {
+	data := pterm.TableData{{"规则", "编译", "正例", "反例", "语料命中", "负样本命中"}}
+	for _, r := range report.Results {
+		compiled := "失败"
+		if r.Compiled {
+			compiled = "通过"
+		}
+		data = append(data, []string{
+			truncate(r.Rule, 40), compiled,
+			fmt.Sprintf("%d/%d", r.PositivePassed, r.Positives),
+			fmt.Sprintf("%d/%d", r.NegativePassed, r.Negatives),
+			fmt.Sprint(r.CorpusHits), fmt.Sprint(r.NegativeHits),
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+	if report.CorpusFiles+report.NegativeFiles > 0 {
+		fmt.Printf("\n语料 %d 个文件，负样本 %d 个文件\n", report.CorpusFiles, report.NegativeFiles)
+	}
+
+	errors, warnings := 0, 0
+	for _, p := range report.Problems {
+		if p.IsError() {
+			errors++
+			pterm.Error.Printfln("[%s] %s: %s", p.Kind, truncate(p.Rule, 40), p.Detail)
+		} else {
+			warnings++
+			pterm.Warning.Printfln("[%s] %s: %s", p.Kind, truncate(p.Rule, 40), p.Detail)
+		}
+	}
+	fmt.Printf("\n%d 个错误，%d 个提示\n", errors, warnings)
+}
+
+// GET /api/rules/profile
+func handleRuleProfile(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, regexManager.Profile())
+}
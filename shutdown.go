@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopr/fuzhu/logger"
+
+	"github.com/elazarl/goproxy"
+)
+
+var (
+	proxyHTTPServer *http.Server
+	shuttingDown    atomic.Bool
+	// 等待在途请求完成的最长时间
+	shutdownTimeout = 15 * time.Second
+	// 退出时等待扫描队列清空的最长时间
+	drainTimeout = time.Minute
+
+	// 已进入代理但还没有处理完响应的请求
+	inFlight      sync.Map
+	inFlightCount atomic.Int64
+	// 已放入扫描队列但还没有扫描完的响应
+	scanPending atomic.Int64
+)
+
+// 开始处理一个请求
+func beginInFlight(ctx *goproxy.ProxyCtx) {
+	if _, loaded := inFlight.LoadOrStore(ctx, struct{}{}); !loaded {
+		inFlightCount.Add(1)
+	}
+}
+
+// 请求处理结束，响应处理完或上游出错时调用，重复调用没有影响
+func endInFlight(ctx *goproxy.ProxyCtx) {
+	if _, loaded := inFlight.LoadAndDelete(ctx); loaded {
+		inFlightCount.Add(-1)
+	}
+}
+
+// 关闭代理时拒绝已建立的中间人连接上的新请求
+func rejectDuringShutdown(req *http.Request) *http.Response {
+	resp := goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusServiceUnavailable, "proxy is shutting down")
+	resp.Header.Set("Connection", "close")
+	return resp
+}
+
+// 依次停止接受连接、等待在途请求、扫描完队列、保存各个存储，最后输出汇总
+func gracefulShutdown() {
+	start := time.Now()
+	shuttingDown.Store(true)
+	deadline := start.Add(shutdownTimeout)
+
+	// 先关闭拦截并放行挂起项，否则被拦截的请求会占住连接直到超时
+	if interceptManager != nil {
+		interceptManager.SetEnabled(false)
+	}
+	if proxyHTTPServer != nil {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		if err := proxyHTTPServer.Shutdown(ctx); err != nil {
+			logger.Warnf("关闭监听失败: %v", err)
+		}
+		cancel()
+	}
+	if !waitUntil(deadline, func() bool { return inFlightCount.Load() == 0 }) {
+		logger.Warnf("仍有 %d 个请求未完成，不再等待", inFlightCount.Load())
+	}
+
+	// 先停止从溢出目录取数据，目录中的响应留到下次启动时扫描，这里只等内存队列
+	if spool != nil {
+		spool.Close()
+		if n := spool.Len(); n > 0 {
+			logger.Infof("溢出目录中还有 %d 个响应，下次启动时继续扫描", n)
+		}
+	}
+	if n := memoryPending(); n > 0 {
+		logger.Infof("正在扫描队列中剩余的 %d 个响应，最多等待 %s，再次按 Ctrl+C 强制退出", n, drainTimeout)
+	}
+	if !waitUntil(time.Now().Add(drainTimeout), func() bool { return memoryPending() <= 0 }) {
+		logger.Warnf("仍有 %d 个响应未扫描，不再等待", memoryPending())
+	}
+
+	if notifier != nil {
+		notifier.Close(5 * time.Second)
+	}
+	if historyStore != nil {
+		historyStore.Flush()
+	}
+	if findingStore != nil {
+		if err := findingStore.Sync(); err != nil {
+			logger.Errorf("保存扫描结果失败: %v", err)
+		}
+	}
+	if harvestStore != nil {
+		if err := harvestStore.Sync(); err != nil {
+			logger.Errorf("保存收集结果失败: %v", err)
+		}
+	}
+	if archiver != nil {
+		if err := archiver.Sync(); err != nil {
+			logger.Errorf("保存归档索引失败: %v", err)
+		}
+	}
+
+	s := currentStats()
+	logger.Infof("已关闭，用时 %s。运行 %s，请求 %d，响应 %d，扫描 %d，丢弃 %d，历史记录 %d，扫描结果 %d，端点 %d，收集 %d",
+		time.Since(start).Round(time.Millisecond), s.Uptime, s.Requests, s.Responses, s.Scanned, s.QueueDropped,
+		s.History, s.Findings, s.Endpoints, s.Harvested)
+}
+
+// 轮询直到条件满足，deadline 为零值时不限时间，超时返回 false
+func waitUntil(deadline time.Time, done func() bool) bool {
+	for !done() {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
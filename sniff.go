@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"gopr/fuzhu"
+
+	"github.com/elazarl/goproxy"
+)
+
+// 预读响应体开头识别内容类型，预读的数据仍留在响应体中
+func sniffResponse(resp *http.Response) fuzhu.ContentClass {
+	if resp.Body == nil || resp.Body == http.NoBody || resp.ContentLength == 0 ||
+		strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return fuzhu.ContentClass{}
+	}
+	// 与扫描时识别用的长度相同，两边对 zip、apk 等的判断一致
+	br := bufio.NewReaderSize(resp.Body, fuzhu.SniffLen)
+	head, _ := br.Peek(fuzhu.SniffLen)
+	class := fuzhu.SniffContent(head)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{br, resp.Body}
+	return class
+}
+
+// 按文件头判断是否跳过扫描，识别不出时按内容类型判断，伪装成图片等类型的文本仍然扫描；
+// 可执行文件、wasm 和压缩过的 Office 文档用正则扫描不出有用的内容，只用于归档和提取元数据
+func shouldSkipContent(contentType string, sniffed fuzhu.ContentClass) bool {
+	switch sniffed.Kind {
+	case fuzhu.ContentImage, fuzhu.ContentFont, fuzhu.ContentMedia, fuzhu.ContentArchive,
+		fuzhu.ContentExecutable, fuzhu.ContentWasm, fuzhu.ContentOffice:
+		return true
+	case fuzhu.ContentText:
+		return shouldSkipContentType(contentType) && fuzhu.DeclaredKind(contentType) == fuzhu.ContentText
+	case "", fuzhu.ContentBinary:
+		return shouldSkipContentType(contentType)
+	}
+	return false
+}
+
+// Content-Type 与文件头不符时记录一条扫描结果，同一主机上同样的不符只记录一次
+func checkContentMismatch(resp *http.Response, ctx *goproxy.ProxyCtx, exchangeID int64, sniffed fuzhu.ContentClass) {
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if _, mismatch := fuzhu.ContentMismatch(contentType, sniffed); !mismatch {
+		return
+	}
+	actual := sniffed.MIME
+	if actual == "" {
+		actual = sniffed.Kind
+	}
+	value := fmt.Sprintf("%s -> %s", strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]), actual)
+	saveFinding(ResponseData{
+		ExchangeID:  exchangeID,
+		Method:      ctx.Req.Method,
+		URL:         ctx.Req.URL.String(),
+		Host:        ctx.Req.URL.Host,
+		StatusCode:  resp.StatusCode,
+		ContentType: contentType,
+	}, fuzhu.Match{
+		Rule:        "content-type-mismatch",
+		Severity:    fuzhu.MismatchSeverity(sniffed),
+		Value:       value,
+		GroupValues: []string{value},
+	}, nil)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+)
+
+// 还原出的源文件保存目录，为空则不保存
+var sourceMapDir string
+
+// 检查 JS 中的 source map 引用，并还原、扫描经过代理的 source map，
+// 返回 true 表示响应本身是已还原并扫描过源文件的 source map
+func checkSourceMap(data ResponseData) bool {
+	if fuzhu.IsSourceMap(data.URL, data.Body) {
+		return scanSourceMap(data, data.Body)
+	}
+	if !strings.Contains(data.ContentType, "javascript") && !strings.HasSuffix(strings.SplitN(data.URL, "?", 2)[0], ".js") {
+		return false
+	}
+	ref := fuzhu.FindSourceMapURL(data.Header, data.Body, data.URL)
+	if ref == "" {
+		return false
+	}
+	if strings.HasPrefix(ref, "data:") {
+		logger.Infof("[sourcemap] %s 包含内联 source map", data.URL)
+		saveSourceMapFinding(data, "sourcemap-inline", fuzhu.SeverityMedium, data.URL)
+		scanSourceMap(data, []byte(ref))
+		return false
+	}
+	logger.Infof("[sourcemap] %s -> %s", data.URL, ref)
+	saveSourceMapFinding(data, "sourcemap-reference", fuzhu.SeverityLow, ref)
+	return false
+}
+
+// 从 sourcesContent 还原源文件，逐个扫描并按需保存
+func scanSourceMap(data ResponseData, raw []byte) bool {
+	sm, err := fuzhu.ParseSourceMap(raw)
+	if err != nil {
+		logger.Debugf("[sourcemap] 解析 %s 失败: %v", data.URL, err)
+		return false
+	}
+	files := sm.Files()
+	if len(files) == 0 {
+		logger.Infof("[sourcemap] %s 共 %d 个源文件，没有 sourcesContent", data.URL, len(sm.Sources))
+		return false
+	}
+	logger.Warnf("[sourcemap] %s 还原出 %d 个源文件", data.URL, len(files))
+	if !bytes.HasPrefix(raw, []byte("data:")) {
+		saveSourceMapFinding(data, "sourcemap-exposed", fuzhu.SeverityMedium, data.URL)
+	}
+
+	if sourceMapDir != "" {
+		if n, err := fuzhu.SaveSources(sourceMapDir, data.Host, files); err != nil {
+			logger.Errorf("[sourcemap] 保存源文件失败: %v", err)
+		} else {
+			logger.Infof("[sourcemap] 已保存 %d 个源文件到 %s", n, sourceMapDir)
+		}
+	}
+	for _, f := range files {
+		src := data
+		src.Body = f.Content
+		src.SourceFile = f.Path
+		src.ContentType = ""
+		scanResponse(src)
+	}
+	return true
+}
+
+func saveSourceMapFinding(data ResponseData, rule, severity, value string) {
+	saveFinding(data, fuzhu.Match{
+		Rule:        rule,
+		Severity:    severity,
+		Value:       value,
+		GroupValues: []string{value},
+	}, nil)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 运行统计
+var stats = struct {
+	Started      time.Time
+	Requests     atomic.Int64
+	Responses    atomic.Int64
+	Scanned      atomic.Int64
+	QueueDropped atomic.Int64
+}{Started: time.Now()}
+
+type statsSnapshot struct {
+	Uptime           string `json:"uptime"`
+	Requests         int64  `json:"requests"`
+	Responses        int64  `json:"responses"`
+	Scanned          int64  `json:"scanned"`
+	QueueDepth       int    `json:"queue_depth"`
+	QueueCapacity    int    `json:"queue_capacity"`
+	QueueDropped     int64  `json:"queue_dropped"`
+	QueueBytes       int64  `json:"queue_bytes"`
+	SpoolItems       int    `json:"spool_items"`
+	SpoolBytes       int64  `json:"spool_bytes"`
+	History          int    `json:"history"`
+	HistoryDropped   int64  `json:"history_dropped"`
+	Findings         int    `json:"findings"`
+	Endpoints        int    `json:"endpoints"`
+	Harvested        int    `json:"harvested"`
+	Archived         int    `json:"archived"`
+	InterceptEnabled bool   `json:"intercept_enabled"`
+	InterceptPending int    `json:"intercept_pending"`
+}
+
+func currentStats() statsSnapshot {
+	s := statsSnapshot{
+		Uptime:           time.Since(stats.Started).Round(time.Second).String(),
+		Requests:         stats.Requests.Load(),
+		Responses:        stats.Responses.Load(),
+		Scanned:          stats.Scanned.Load(),
+		QueueDepth:       len(responseQueue),
+		QueueCapacity:    cap(responseQueue),
+		QueueDropped:     stats.QueueDropped.Load(),
+		QueueBytes:       queuedBytes.Load(),
+		Endpoints:        endpointInventory.Count(),
+		InterceptEnabled: interceptManager.Enabled(),
+		InterceptPending: len(interceptManager.Pending()),
+	}
+	spooled := spoolStats()
+	s.SpoolItems, s.SpoolBytes = spooled.Items, spooled.Bytes
+	if historyStore != nil {
+		s.History = historyStore.Count()
+		s.HistoryDropped = historyStore.Dropped()
+	}
+	if findingStore != nil {
+		s.Findings = findingStore.Count()
+	}
+	if harvestStore != nil {
+		s.Harvested = harvestStore.Count()
+	}
+	if archiver != nil {
+		s.Archived = archiver.Stats().Entries
+	}
+	return s
+}
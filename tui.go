@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"gopr/fuzhu"
+	"gopr/fuzhu/logger"
+
+	"atomicgo.dev/keyboard"
+	"atomicgo.dev/keyboard/keys"
+	"github.com/pterm/pterm"
+)
+
+// 终端界面最多保留的日志行数
+const tuiLogLines = 5
+
+// 在编辑器中修改挂起项时的截止时间
+const tuiEditTimeout = time.Hour
+
+// 交互式终端界面，替代滚动日志
+type tui struct {
+	area     *pterm.AreaPrinter
+	logs     *tuiLogBuffer
+	selected int // 选中行在最近记录中的下标，0为最新
+	detail   bool
+	message  string
+	stopped  bool
+	// 拦截列表视图及其中选中的挂起项下标，按挂起顺序
+	intercepts   bool
+	interceptSel int
+	editID       int64 // 等待在编辑器中修改的挂起项，键盘监听停止后处理
+	editing      bool
+	mu           sync.Mutex
+}
+
+// 收集控制台日志，只保留最后几行
+type tuiLogBuffer struct {
+	lines []string
+	mu    sync.Mutex
+}
+
+func (b *tuiLogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		b.lines = append(b.lines, line)
+	}
+	if len(b.lines) > tuiLogLines {
+		b.lines = b.lines[len(b.lines)-tuiLogLines:]
+	}
+	return len(p), nil
+}
+
+func (b *tuiLogBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Join(b.lines, "\n")
+}
+
+func startTUI() {
+	t := &tui{logs: &tuiLogBuffer{}}
+	logger.SetConsoleWriter(t.logs)
+
+	area, err := pterm.DefaultArea.WithFullscreen(true).Start()
+	if err != nil {
+		logger.SetConsoleWriter(os.Stdout)
+		logger.Errorf("启动终端界面失败: %v", err)
+		return
+	}
+	t.area = area
+
+	go func() {
+		for range time.Tick(500 * time.Millisecond) {
+			t.render()
+		}
+	}()
+	go t.listen()
+}
+
+// 编辑挂起项时停止键盘监听，把终端交给编辑器，编辑完再恢复
+func (t *tui) listen() {
+	for {
+		if err := keyboard.Listen(t.onKey); err != nil {
+			logger.Errorf("读取键盘输入失败: %v", err)
+			return
+		}
+		t.mu.Lock()
+		id, stopped := t.editID, t.stopped
+		t.editID = 0
+		editing := id != 0 && !stopped
+		t.editing = editing
+		t.mu.Unlock()
+		if !editing {
+			return
+		}
+		message := t.editIntercept(id)
+		t.mu.Lock()
+		t.editing = false
+		t.message = message
+		t.mu.Unlock()
+		t.render()
+	}
+}
+
+// 在 $VISUAL 或 $EDITOR 中编辑挂起项，保存后按编辑内容放行。
+// 编辑期间推迟截止时间，未放行时恢复为默认的拦截超时
+func (t *tui) editIntercept(id int64) string {
+	item, ok := interceptManager.Get(id)
+	if !ok {
+		return fmt.Sprintf("#%d 已不在拦截列表中", id)
+	}
+	if _, err := interceptManager.Extend(id, tuiEditTimeout); err != nil {
+		return fmt.Sprintf("#%d 已不在拦截列表中", id)
+	}
+	resolved := false
+	defer func() {
+		if !resolved {
+			interceptManager.Extend(id, 0)
+		}
+	}()
+	file, err := os.CreateTemp("", "gopr-intercept-*.txt")
+	if err != nil {
+		return "创建临时文件失败: " + err.Error()
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(formatInterceptItem(item))
+	file.Close()
+	if err != nil {
+		return "写入临时文件失败: " + err.Error()
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", file.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "编辑器退出异常，未放行: " + err.Error()
+	}
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "读取编辑结果失败: " + err.Error()
+	}
+	d, err := parseInterceptEdit(item, data)
+	if err != nil {
+		return "编辑结果无效，未放行: " + err.Error()
+	}
+	if err := interceptManager.Resolve(id, d); err != nil {
+		return fmt.Sprintf("#%d 放行失败: %v", id, err)
+	}
+	resolved = true
+	return fmt.Sprintf("已按编辑内容放行 #%d", id)
+}
+
+// 拦截列表中选中的挂起项
+func (t *tui) selectedIntercept() (*fuzhu.InterceptItem, bool) {
+	items := interceptManager.Pending()
+	if t.interceptSel >= len(items) {
+		return nil, false
+	}
+	return items[t.interceptSel], true
+}
+
+// 最近的记录，最新的在前
+func (t *tui) recent(n int) []fuzhu.ExchangeSummary {
+	if historyStore == nil {
+		return nil
+	}
+	all := historyStore.Summaries()
+	list := make([]fuzhu.ExchangeSummary, 0, n)
+	for i := len(all) - 1; i >= 0 && len(list) < n; i-- {
+		list = append(list, all[i])
+	}
+	return list
+}
+
+func (t *tui) onKey(key keys.Key) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch key.Code {
+	case keys.CtrlC:
+		t.quit()
+		return true, nil
+	case keys.Up:
+		if t.intercepts {
+			if t.interceptSel > 0 {
+				t.interceptSel--
+			}
+		} else if t.selected > 0 {
+			t.selected--
+		}
+	case keys.Down:
+		if t.intercepts {
+			t.interceptSel++
+		} else {
+			t.selected++
+		}
+	case keys.Enter:
+		t.detail = !t.detail
+	case keys.Escape:
+		t.detail = false
+	case keys.RuneKey:
+		switch key.String() {
+		case "q":
+			t.quit()
+			return true, nil
+		case "s":
+			cfg := scopeManager.Config()
+			scopeManager.SetEnabled(!cfg.Enabled)
+			t.message = fmt.Sprintf("扫描范围限制: %v", !cfg.Enabled)
+		case "a", "x":
+			list := t.recent(t.selected + 1)
+			if t.selected >= len(list) {
+				break
+			}
+			domain := extractMainDomain(list[t.selected].Host)
+			if key.String() == "a" {
+				scopeManager.Include(domain)
+				scopeManager.SetEnabled(true)
+				t.message = "已加入扫描范围: " + domain
+			} else {
+				scopeManager.Exclude(domain)
+				t.message = "已排除: " + domain
+			}
+		case "i":
+			interceptManager.SetEnabled(!interceptManager.Enabled())
+			t.message = fmt.Sprintf("拦截: %v", interceptManager.Enabled())
+		case "p":
+			t.intercepts = !t.intercepts
+			t.detail = false
+		case "F":
+			interceptManager.ForwardAll()
+			t.message = "已放行所有拦截项"
+		case "f", "d", "e":
+			// 请求列表中 f 仍为全部放行
+			if !t.intercepts {
+				if key.String() == "f" {
+					interceptManager.ForwardAll()
+					t.message = "已放行所有拦截项"
+				}
+				break
+			}
+			item, ok := t.selectedIntercept()
+			if !ok {
+				break
+			}
+			switch key.String() {
+			case "f":
+				if err := interceptManager.Forward(item.ID); err != nil {
+					t.message = fmt.Sprintf("#%d 放行失败: %v", item.ID, err)
+				} else {
+					t.message = fmt.Sprintf("已放行 #%d", item.ID)
+				}
+			case "d":
+				if err := interceptManager.Drop(item.ID); err != nil {
+					t.message = fmt.Sprintf("#%d 丢弃失败: %v", item.ID, err)
+				} else {
+					t.message = fmt.Sprintf("已丢弃 #%d", item.ID)
+				}
+			case "e":
+				// 停止键盘监听后由 listen 打开编辑器
+				t.editID = item.ID
+				return true, nil
+			}
+		}
+	}
+	go t.render()
+	return false, nil
+}
+
+// 退出时恢复终端再触发关闭流程
+func (t *tui) quit() {
+	t.stopped = true
+	t.area.Stop()
+	logger.SetConsoleWriter(os.Stdout)
+	fuzhu.RequestShutdown()
+}
+
+func (t *tui) render() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped || t.editing {
+		return
+	}
+
+	width, height := pterm.GetTerminalWidth(), pterm.GetTerminalHeight()
+	var buf bytes.Buffer
+
+	s := currentStats()
+	scope := scopeManager.Config()
+	fmt.Fprintf(&buf, "%s  请求 %d | 已扫描 %d | 队列 %d/%d | 丢弃 %d | 范围限制 %v | 拦截 %v (%d)\n",
+		pterm.Bold.Sprint("gopr"), s.Requests, s.Scanned, s.QueueDepth, s.QueueCapacity, s.QueueDropped,
+		scope.Enabled, s.InterceptEnabled, s.InterceptPending)
+	buf.WriteString(t.severityLine() + "\n\n")
+
+	// 表格以外的行：状态2行、空行、表头、日志、提示
+	rows := height - tuiLogLines - 8
+	if rows < 3 {
+		rows = 3
+	}
+	list := t.recent(rows)
+	if t.selected >= len(list) && len(list) > 0 {
+		t.selected = len(list) - 1
+	}
+
+	help := "↑/↓ 选择  Enter 详情  s 范围开关  a 加入范围  x 排除域名  i 拦截开关  p 拦截列表  f 全部放行  q 退出"
+	switch {
+	case t.intercepts:
+		buf.WriteString(t.interceptTable(width, rows))
+		help = "↑/↓ 选择  f 放行  d 丢弃  e 编辑后放行  F 全部放行  i 拦截开关  p 返回请求列表  q 退出"
+	case t.detail && t.selected < len(list):
+		buf.WriteString(t.detailPane(list[t.selected].ID, width, rows))
+	default:
+		buf.WriteString(t.requestTable(list, width))
+	}
+
+	buf.WriteString("\n" + pterm.Gray(t.logs.String()) + "\n")
+	if t.message != "" {
+		help = t.message + "  |  " + help
+	}
+	buf.WriteString(pterm.Gray(help))
+	// 键盘监听会把终端设为 raw 模式，换行需要带上回车
+	t.area.Update(strings.ReplaceAll(buf.String(), "\n", "\r\n"))
+}
+
+// 按严重程度统计结果，不含误报
+func (t *tui) severityLine() string {
+	counts := make(map[string]int)
+	if findingStore != nil {
+		for _, f := range findingStore.List() {
+			if !f.FalsePositive {
+				counts[f.Severity]++
+			}
+		}
+	}
+	styles := map[string]pterm.Color{
+		fuzhu.SeverityCritical: pterm.FgMagenta,
+		fuzhu.SeverityHigh:     pterm.FgRed,
+		fuzhu.SeverityMedium:   pterm.FgYellow,
+		fuzhu.SeverityLow:      pterm.FgCyan,
+		fuzhu.SeverityInfo:     pterm.FgGray,
+	}
+	parts := make([]string, 0, len(fuzhu.Severities))
+	for _, sev := range fuzhu.Severities {
+		parts = append(parts, styles[sev].Sprintf("%s %d", sev, counts[sev]))
+	}
+	return "结果: " + strings.Join(parts, "  ")
+}
+
+func (t *tui) requestTable(list []fuzhu.ExchangeSummary, width int) string {
+	if historyStore == nil {
+		return pterm.Gray("终端界面的请求列表需要启用历史记录 (-history)") + "\n"
+	}
+	urlWidth := width - 40
+	if urlWidth < 20 {
+		urlWidth = 20
+	}
+	data := pterm.TableData{{"#", "方法", "状态", "URL", "长度"}}
+	for _, s := range list {
+		data = append(data, []string{
+			fmt.Sprint(s.ID), s.Method, fmt.Sprint(s.StatusCode), truncate(s.URL, urlWidth), fmt.Sprint(s.Length),
+		})
+	}
+	out, err := pterm.DefaultTable.WithHasHeader().WithData(data).Srender()
+	if err != nil {
+		return err.Error() + "\n"
+	}
+	// 高亮选中行，表头占第一行
+	lines := strings.Split(out, "\n")
+	if i := t.selected + 1; i < len(lines) {
+		lines[i] = pterm.BgBlue.Sprint(lines[i])
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// 挂起的请求和响应，最早挂起的在前
+func (t *tui) interceptTable(width, rows int) string {
+	items := interceptManager.Pending()
+	if len(items) == 0 {
+		t.interceptSel = 0
+		return pterm.Gray("没有挂起的请求或响应，按 i 开启拦截") + "\n"
+	}
+	if len(items) > rows {
+		items = items[:rows]
+	}
+	if t.interceptSel >= len(items) {
+		t.interceptSel = len(items) - 1
+	}
+	urlWidth := width - 50
+	if urlWidth < 20 {
+		urlWidth = 20
+	}
+	data := pterm.TableData{{"#", "阶段", "方法", "状态", "URL", "剩余"}}
+	for _, item := range items {
+		status := ""
+		if item.StatusCode != 0 {
+			status = fmt.Sprint(item.StatusCode)
+		}
+		data = append(data, []string{
+			fmt.Sprint(item.ID), phaseLabel(item.Phase), item.Method, status, truncate(item.URL, urlWidth),
+			time.Until(item.Deadline).Round(time.Second).String(),
+		})
+	}
+	out, err := pterm.DefaultTable.WithHasHeader().WithData(data).Srender()
+	if err != nil {
+		return err.Error() + "\n"
+	}
+	lines := strings.Split(out, "\n")
+	if i := t.interceptSel + 1; i < len(lines) {
+		lines[i] = pterm.BgBlue.Sprint(lines[i])
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func phaseLabel(phase string) string {
+	if phase == fuzhu.InterceptPhaseResponse {
+		return "响应"
+	}
+	return "请求"
+}
+
+func (t *tui) detailPane(id int64, width, rows int) string {
+	ex, err := historyStore.Get(id)
+	if err != nil {
+		return err.Error() + "\n"
+	}
+	// 先截断再着色，避免截断颜色控制符
+	lines := []string{pterm.Bold.Sprint(truncate(fmt.Sprintf("#%d %s %s -> %d (%s)", ex.ID, ex.Method, ex.URL, ex.StatusCode, ex.Duration.Round(time.Millisecond)), width))}
+	if findingStore != nil {
+		for _, f := range findingStore.List() {
+			if f.ExchangeID == ex.ID {
+				lines = append(lines, pterm.Red(truncate(fmt.Sprintf("[%s] %s: %s", f.Severity, truncate(f.Rule, 40), f.Value), width)))
+			}
+		}
+	}
+	for k, v := range ex.ResponseHeader {
+		lines = append(lines, truncate(k+": "+strings.Join(v, ", "), width))
+	}
+	lines = append(lines, "")
+	for _, line := range strings.Split(string(ex.ResponseBody), "\n") {
+		if len(lines) > rows {
+			break
+		}
+		lines = append(lines, truncate(strings.TrimRight(line, "\r"), width))
+	}
+	if len(lines) > rows+1 {
+		lines = lines[:rows+1]
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n <= 3 {
+		return string(r[:n])
+	}
+	return string(r[:n-3]) + "..."
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed webui
+var webUIFiles embed.FS
+
+// 网页界面，挂载在控制接口的 /ui/ 下
+func webUIHandler() http.Handler {
+	sub, err := fs.Sub(webUIFiles, "webui")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(sub)))
+}
@@ -0,0 +1,228 @@
+// gopr 网页界面，数据全部来自 /api
+(function () {
+  'use strict';
+
+  // 令牌从 #token= 读取后保存在 localStorage
+  const hashToken = new URLSearchParams(location.hash.slice(1)).get('token');
+  if (hashToken) {
+    localStorage.setItem('gopr-token', hashToken);
+    history.replaceState(null, '', location.pathname);
+  }
+  let token = localStorage.getItem('gopr-token') || '';
+  if (!token) {
+    token = prompt('控制接口令牌') || '';
+    localStorage.setItem('gopr-token', token);
+  }
+
+  async function api(path, options = {}) {
+    options.headers = Object.assign({ 'X-Gopr-Token': token }, options.headers || {});
+    const resp = await fetch('/api' + path, options);
+    if (resp.status === 401) {
+      localStorage.removeItem('gopr-token');
+      throw new Error('令牌无效');
+    }
+    if (!resp.ok) {
+      throw new Error((await resp.json()).error || resp.statusText);
+    }
+    return resp.json();
+  }
+
+  const $ = (sel, root = document) => root.querySelector(sel);
+  const el = (tag, props = {}, children = []) => {
+    const node = Object.assign(document.createElement(tag), props);
+    for (const c of children) node.append(c);
+    return node;
+  };
+
+  // ---------- 解码 ----------
+
+  function b64ToBytes(b64) {
+    if (!b64) return new Uint8Array();
+    const bin = atob(b64);
+    const bytes = new Uint8Array(bin.length);
+    for (let i = 0; i < bin.length; i++) bytes[i] = bin.charCodeAt(i);
+    return bytes;
+  }
+
+  const utf8 = new TextDecoder('utf-8');
+
+  function decode(bytes, mode) {
+    const text = utf8.decode(bytes);
+    try {
+      switch (mode) {
+        case 'json':
+          return JSON.stringify(JSON.parse(text), null, 2);
+        case 'url':
+          return decodeURIComponent(text.replace(/\+/g, ' '));
+        case 'base64':
+          return utf8.decode(b64ToBytes(text.trim().replace(/-/g, '+').replace(/_/g, '/')));
+        case 'unicode':
+          return text.replace(/\\u([0-9a-fA-F]{4})/g, (_, h) => String.fromCharCode(parseInt(h, 16)))
+            .replace(/\\x([0-9a-fA-F]{2})/g, (_, h) => String.fromCharCode(parseInt(h, 16)));
+        case 'hex':
+          return Array.from(bytes.slice(0, 65536), b => b.toString(16).padStart(2, '0')).join(' ');
+      }
+    } catch (e) {
+      return '解码失败: ' + e.message + '\n\n' + text;
+    }
+    return text;
+  }
+
+  function formatHeaders(header) {
+    return Object.entries(header || {})
+      .map(([k, vs]) => vs.map(v => k + ': ' + v).join('\n'))
+      .join('\n');
+  }
+
+  // ---------- 流量 ----------
+
+  const rows = $('#traffic-rows');
+  let lastID = 0;
+  let selected = null;
+
+  function matchesSearch(text) {
+    const q = $('#search').value.trim();
+    return !q || text.includes(q);
+  }
+
+  function addTrafficRow(s) {
+    const tr = el('tr', {}, [
+      el('td', { textContent: s.id }),
+      el('td', { textContent: s.method }),
+      el('td', { textContent: s.status_code }),
+      el('td', { className: 'url', textContent: s.url, title: s.url }),
+      el('td', { textContent: (s.content_type || '').split(';')[0] }),
+      el('td', { textContent: s.length }),
+    ]);
+    tr.dataset.url = s.url;
+    tr.hidden = !matchesSearch(s.url);
+    tr.onclick = () => showExchange(s.id, tr);
+    rows.prepend(tr);
+  }
+
+  async function pollTraffic() {
+    try {
+      const page = await api('/history?limit=500&after=' + lastID);
+      for (const s of page.items) {
+        addTrafficRow(s);
+        lastID = Math.max(lastID, s.id);
+      }
+    } catch (e) {
+      console.warn(e);
+    }
+  }
+
+  async function showExchange(id, tr) {
+    if (selected) selected.classList.remove('selected');
+    selected = tr;
+    tr.classList.add('selected');
+
+    const ex = await api('/history/' + id);
+    const detail = $('#traffic-detail');
+    detail.replaceChildren($('#detail-tpl').content.cloneNode(true));
+    $('.title', detail).textContent = '#' + ex.id + ' ' + ex.method + ' ' + ex.url;
+    $('.req-head', detail).textContent = formatHeaders(ex.request_header);
+    $('.resp-head', detail).textContent = 'HTTP ' + ex.status_code + '\n' + formatHeaders(ex.response_header);
+
+    const reqBody = b64ToBytes(ex.request_body);
+    const respBody = b64ToBytes(ex.response_body);
+    const render = () => {
+      const mode = $('.decode', detail).value;
+      $('.req-body', detail).textContent = decode(reqBody, mode);
+      $('.resp-body', detail).textContent = decode(respBody, mode);
+    };
+    $('.decode', detail).onchange = render;
+    render();
+  }
+
+  // ---------- 扫描结果 ----------
+
+  // 鼠标悬停显示位置和上下文
+  function contextTitle(f) {
+    const c = f.context;
+    if (!c) return f.value;
+    const loc = c.line + ':' + c.column + (c.minified ? ' (offset ' + c.offset + ', ~pretty line ' + c.pretty_line + ')' : '');
+    let where = f.decoding ? '[' + f.decoding + '] ' + loc : loc;
+    if (f.path) where = f.path;
+    if (f.source_file) where = f.source_file + ' ' + where;
+    return where + '\n' + (c.before || '') + '«' + c.value + '»' + (c.after || '');
+  }
+
+  async function loadFindings() {
+    const fp = $('#show-fp').checked ? '' : '&fp=0';
+    const q = encodeURIComponent($('#search').value.trim());
+    const page = await api('/findings?limit=100000&q=' + q + fp);
+
+    // 按规则和主机分组
+    const groups = new Map();
+    for (const f of page.items) {
+      const key = f.rule + '\u0000' + f.host;
+      if (!groups.has(key)) groups.set(key, { rule: f.rule, host: f.host, items: [] });
+      groups.get(key).items.push(f);
+    }
+
+    const container = $('#finding-groups');
+    container.replaceChildren();
+    for (const g of groups.values()) {
+      const tbody = el('tbody');
+      for (const f of g.items) {
+        const fpBox = el('input', { type: 'checkbox', checked: !!f.false_positive, title: '标记为误报' });
+        const tr = el('tr', { className: f.false_positive ? 'fp' : '' }, [
+          el('td', { textContent: f.id }),
+          el('td', { className: 'value', textContent: f.value, title: contextTitle(f) }),
+          el('td', { textContent: f.hits }),
+          el('td', { className: 'url', textContent: f.url, title: f.url }),
+          el('td', {}, [fpBox]),
+        ]);
+        fpBox.onchange = async () => {
+          await api('/findings/' + f.id, {
+            method: 'PUT',
+            body: JSON.stringify({ false_positive: fpBox.checked }),
+          });
+          tr.className = fpBox.checked ? 'fp' : '';
+        };
+        tbody.append(tr);
+      }
+      container.append(el('div', { className: 'group' }, [
+        el('h4', {}, [g.rule + ' ', el('span', { className: 'host', textContent: '@ ' + g.host + ' (' + g.items.length + ')' })]),
+        el('table', {}, [
+          el('thead', {}, [el('tr', {}, ['#', '值', '次数', 'URL', '误报'].map(t => el('th', { textContent: t })))]),
+          tbody,
+        ]),
+      ]));
+    }
+  }
+
+  // ---------- 状态栏 ----------
+
+  async function pollStats() {
+    try {
+      const s = await api('/stats');
+      $('#stats').textContent = `请求 ${s.requests} | 队列 ${s.queue_depth}/${s.queue_capacity} | 丢弃 ${s.queue_dropped} | 结果 ${s.findings}`;
+    } catch (e) {
+      $('#stats').textContent = e.message;
+    }
+  }
+
+  // ---------- 事件 ----------
+
+  for (const btn of document.querySelectorAll('nav button')) {
+    btn.onclick = () => {
+      document.querySelectorAll('nav button, .tab').forEach(n => n.classList.remove('active'));
+      btn.classList.add('active');
+      $('#' + btn.dataset.tab).classList.add('active');
+      if (btn.dataset.tab === 'findings') loadFindings();
+    };
+  }
+
+  $('#search').oninput = () => {
+    for (const tr of rows.children) tr.hidden = !matchesSearch(tr.dataset.url);
+    if ($('#findings').classList.contains('active')) loadFindings();
+  };
+  $('#show-fp').onchange = loadFindings;
+
+  pollTraffic();
+  pollStats();
+  setInterval(pollTraffic, 2000);
+  setInterval(pollStats, 5000);
+})();